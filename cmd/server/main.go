@@ -20,26 +20,54 @@ func main() {
 	var address string
 	var socketDir string
 	var hostKey string
+	var tcpForward bool
+	var udpForward bool
 
 	cmd := &cobra.Command{
 		Use: "srp-server",
 		Run: func(cmd *cobra.Command, args []string) {
-			rp, err := reverseproxy.New(nil, nil, socketDir)
+			listenMode := reverseproxy.ListenModeMemory
+			if tcpForward {
+				listenMode = reverseproxy.ListenModeTCP
+			}
+			rp, err := reverseproxy.NewWithOptions(
+				reverseproxy.WithUnixDirectory(socketDir),
+				reverseproxy.WithListenMode(listenMode),
+			)
 			if err != nil {
 				logrus.Fatalln("Error:", err)
 			}
-			p := proxy.New(nil, nil, providers.SocketProvider(rp, 0), true)
+			proxyOptions := []proxy.Option{
+				proxy.WithProxyProvider(providers.NetDialerProvider(rp)),
+				proxy.WithCacheEnabled(true),
+			}
+			if udpForward {
+				// 客户端 UDP 本地转发的目标由服务端直接连接
+				proxyOptions = append(proxyOptions, proxy.WithUDPProxyProvider(providers.UDPProvider))
+			}
+			p := proxy.NewWithOptions(proxyOptions...)
 
 			s := server.New(
 				name,
 				server.WithReverseProxy(rp),
 				server.WithProxy(p),
+				server.WithHostKeyPath(hostKey),
 				server.WithSSHOptions(
-					wish.WithHostKeyPath(hostKey),
 					wish.WithAddress(address),
 				),
 			)
 
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			defer signal.Stop(hup)
+			go func() {
+				for range hup {
+					if err := s.ReloadHostKey(); err != nil {
+						logrus.Errorln("Failed to reload host key:", err)
+					}
+				}
+			}()
+
 			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 			defer cancel()
 
@@ -52,6 +80,8 @@ func main() {
 	cmd.Flags().StringVarP(&address, "address", "a", "127.0.0.1:22", "SRP listen address")
 	cmd.Flags().StringVarP(&socketDir, "socket-dir", "d", "", "Path for unix socket files")
 	cmd.Flags().StringVarP(&hostKey, "host-key", "k", "ssh_host_ed25519_key", "Host Key File for SSH Server")
+	cmd.Flags().BoolVar(&tcpForward, "tcp-forward", false, "Also listen remote forwards on TCP ports")
+	cmd.Flags().BoolVar(&udpForward, "udp-forward", false, "Allow clients to forward UDP to targets reachable from the server")
 
 	_ = cmd.Execute()
 }
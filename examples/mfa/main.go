@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/wish"
+	"github.com/pigeonligh/srp/pkg/auth"
+	"github.com/pigeonligh/srp/pkg/reverseproxy"
+	"github.com/pigeonligh/srp/pkg/server"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	name    = "SRP MFA Example"
+	address = "127.0.0.1:8022"
+	hostKey = "examples/common/host_key"
+
+	passwords = auth.UserPasswordMap{
+		"rpuser": "password",
+	}
+	// base32 编码的 TOTP 密钥，可以导入到 Google Authenticator 等应用中
+	totpSecrets = map[string]string{
+		"rpuser": "JBSWY3DPEHPK3PXP",
+	}
+)
+
+func main() {
+	rp, err := reverseproxy.NewWithOptions(
+		reverseproxy.WithKeyboardInteractiveAuthenticator(auth.PasswordTOTPAuthenticator(
+			auth.UserPasswordAuthenticator(passwords),
+			func(user string) (string, bool) {
+				secret, ok := totpSecrets[user]
+				return secret, ok
+			},
+		)),
+		// 不允许跳过第二因素直接使用密码或公钥登录
+		reverseproxy.WithAuthenticator(auth.AuthenticateFunc(func(context.Context, auth.AuthenticateRequest) bool {
+			return false
+		})),
+	)
+	if err != nil {
+		logrus.Fatalln("Error:", err)
+	}
+
+	s := server.New(
+		name,
+		server.WithReverseProxy(rp),
+		server.WithSSHOptions(
+			wish.WithHostKeyPath(hostKey),
+			wish.WithAddress(address),
+		),
+	)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := s.Run(ctx); err != nil {
+		logrus.Fatalln("Error:", err)
+	}
+}
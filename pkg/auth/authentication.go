@@ -2,11 +2,34 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"net"
 
 	gossh "golang.org/x/crypto/ssh"
 )
 
+// SSH 认证方式的名称
+const (
+	MethodPassword            = "password"
+	MethodPublicKey           = "publickey"
+	MethodKeyboardInteractive = "keyboard-interactive"
+)
+
+// CheckMethods 检查启用的认证方式，为空时 ssh.Server 会跳过认证，因此返回错误
+func CheckMethods(methods map[string]bool) error {
+	if len(methods) == 0 {
+		return fmt.Errorf("no authentication method is enabled")
+	}
+	for m := range methods {
+		switch m {
+		case MethodPassword, MethodPublicKey, MethodKeyboardInteractive:
+		default:
+			return fmt.Errorf("unknown authentication method %q", m)
+		}
+	}
+	return nil
+}
+
 // req
 
 type AuthenticateRequest struct {
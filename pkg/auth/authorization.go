@@ -12,6 +12,9 @@ type AuthorizeRequest struct {
 	Target     string
 	RemoteAddr net.Addr
 	LocalAddr  net.Addr
+
+	// Identity 为认证阶段得到的身份信息，见 IdentityFromContext，没有时为 nil
+	Identity *Identity
 }
 
 // def
@@ -44,3 +47,29 @@ func (slice Authorizers) Authorize(ctx context.Context, req AuthorizeRequest) bo
 func MergeAuthorizers(slice ...Authorizer) Authorizer {
 	return Authorizers(slice)
 }
+
+// combinators
+
+// AnyOf 任一 Authorizer 通过即通过，与 MergeAuthorizers 相同
+func AnyOf(slice ...Authorizer) Authorizer {
+	return Authorizers(slice)
+}
+
+// AllOf 所有 Authorizer 都通过才通过，遇到拒绝时立即返回
+func AllOf(slice ...Authorizer) Authorizer {
+	return AuthorizeFunc(func(ctx context.Context, req AuthorizeRequest) bool {
+		for _, a := range slice {
+			if !a.Authorize(ctx, req) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Not 对 Authorizer 的结果取反，可以与 AllOf 组合实现拒绝规则
+func Not(a Authorizer) Authorizer {
+	return AuthorizeFunc(func(ctx context.Context, req AuthorizeRequest) bool {
+		return !a.Authorize(ctx, req)
+	})
+}
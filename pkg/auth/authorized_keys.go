@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/netip"
+	"path"
+	"strings"
+
+	"github.com/pigeonligh/srp/pkg/protocol"
+	"github.com/sirupsen/logrus"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// AuthorizedKeyOptions 是 authorized_keys 中与公钥对应的选项
+type AuthorizedKeyOptions struct {
+	Command string
+	From    []string
+	Options []string
+}
+
+// AuthorizedKeysAuthenticator 使用 OpenSSH authorized_keys 文件校验公钥，文件修改后自动重新加载
+// 带有 from= 选项的公钥只接受来自匹配地址的连接，命中的公钥如果带有选项，会写入 context 供后续授权使用
+func AuthorizedKeysAuthenticator(path string) Authenticator {
+	file := newReloadingFile(path, parseAuthorizedKeys)
+	return AuthenticateFunc(func(ctx context.Context, req AuthenticateRequest) bool {
+		if req.PublicKey == nil {
+			return false
+		}
+		keys, ok := file.Load()
+		if !ok {
+			return false
+		}
+		options, ok := keys[string(req.PublicKey.Marshal())]
+		if !ok {
+			return false
+		}
+		if len(options.From) > 0 && !matchFrom(options.From, req.RemoteAddr) {
+			logrus.Warnf("Public key of user %v is not allowed from %v", req.User, req.RemoteAddr)
+			return false
+		}
+		if c, ok := ctx.(interface{ SetValue(key, value any) }); ok && len(options.Options) > 0 {
+			c.SetValue(protocol.ContextKeyAuthorizedKeyOptions, options)
+		}
+		return true
+	})
+}
+
+func AuthorizedKeyOptionsFromContext(ctx context.Context) (AuthorizedKeyOptions, bool) {
+	options, ok := ctx.Value(protocol.ContextKeyAuthorizedKeyOptions).(AuthorizedKeyOptions)
+	return options, ok
+}
+
+func parseAuthorizedKeys(data []byte) (map[string]AuthorizedKeyOptions, error) {
+	ret := make(map[string]AuthorizedKeyOptions)
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, options, rest, err := gossh.ParseAuthorizedKey(data)
+		if err != nil {
+			// ParseAuthorizedKey 会跳过无法解析的行，只有没有任何可用的公钥时才会出错
+			break
+		}
+		data = rest
+
+		k := AuthorizedKeyOptions{
+			Options: options,
+		}
+		for _, option := range options {
+			name, value, found := strings.Cut(option, "=")
+			if !found {
+				continue
+			}
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(name) {
+			case "command":
+				k.Command = value
+			case "from":
+				k.From = strings.Split(value, ",")
+			}
+		}
+		ret[string(key.Marshal())] = k
+	}
+	return ret, nil
+}
+
+// matchFrom 按 OpenSSH 的 from= 规则匹配来源 IP，支持 CIDR、* 和 ? 通配符以及 ! 取反，
+// 命中取反的模式时直接拒绝；不做反向解析，主机名模式不会匹配任何地址
+func matchFrom(patterns []string, remoteAddr net.Addr) bool {
+	if remoteAddr == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr.String())
+	if err != nil {
+		host = remoteAddr.String()
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap().WithZone("")
+
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if !matchAddress(pattern, ip) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+func matchAddress(pattern string, ip netip.Addr) bool {
+	if strings.Contains(pattern, "/") {
+		prefix, err := netip.ParsePrefix(pattern)
+		return err == nil && prefix.Contains(ip)
+	}
+	ok, _ := path.Match(pattern, ip.String())
+	return ok
+}
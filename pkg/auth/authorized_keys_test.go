@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestAuthorizedKeysFrom(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := `from="10.0.0.0/8,192.168.1.?,!10.0.0.13" ` + string(gossh.MarshalAuthorizedKey(signer.PublicKey()))
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := os.WriteFile(path, []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator := AuthorizedKeysAuthenticator(path)
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3:22", true},
+		{"192.168.1.7:22", true},
+		{"[::ffff:10.1.2.3]:22", true},
+		{"10.0.0.13:22", false},
+		{"192.168.1.17:22", false},
+		{"172.16.0.1:22", false},
+	}
+	for _, tt := range tests {
+		addr, err := net.ResolveTCPAddr("tcp", tt.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := authenticator.Authenticate(context.Background(), AuthenticateRequest{
+			User:       "u",
+			PublicKey:  signer.PublicKey(),
+			RemoteAddr: addr,
+		})
+		if got != tt.want {
+			t.Errorf("Authenticate from %v = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// 认证失败的结果默认缓存的时间，用于减缓暴力破解
+var DefaultNegativeCacheTTL = 5 * time.Second
+
+type CachingOption func(*cachingAuthenticator)
+
+func WithNegativeCacheTTL(ttl time.Duration) CachingOption {
+	return func(a *cachingAuthenticator) {
+		a.negativeTTL = ttl
+	}
+}
+
+type cacheEntry struct {
+	key     [sha256.Size]byte
+	ok      bool
+	expires time.Time
+	// 认证时写入 context 的值，命中缓存时重新写入
+	values []contextValue
+}
+
+type contextValue struct {
+	key, value any
+}
+
+type cachingAuthenticator struct {
+	inner       Authenticator
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+	secret      []byte
+
+	mutex   sync.Mutex
+	lru     *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+// CachingAuthenticator 缓存 inner 的认证结果，成功的结果缓存 ttl，失败的结果缓存较短的时间
+// 缓存的 key 是用户名与凭据的 HMAC，不会保存原始密码
+func CachingAuthenticator(inner Authenticator, ttl time.Duration, maxEntries int, opts ...CachingOption) Authenticator {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	a := &cachingAuthenticator{
+		inner:       inner,
+		ttl:         ttl,
+		negativeTTL: min(ttl, DefaultNegativeCacheTTL),
+		maxEntries:  maxEntries,
+		secret:      secret,
+		lru:         list.New(),
+		entries:     make(map[[sha256.Size]byte]*list.Element),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *cachingAuthenticator) Authenticate(ctx context.Context, req AuthenticateRequest) bool {
+	key := a.key(req)
+	if entry, ok := a.get(key); ok {
+		if c, ok := ctx.(interface{ SetValue(key, value any) }); ok {
+			for _, v := range entry.values {
+				c.SetValue(v.key, v.value)
+			}
+		}
+		return entry.ok
+	}
+
+	rc := &recordingContext{Context: ctx}
+	ok := a.inner.Authenticate(rc, req)
+	ttl := a.ttl
+	if !ok {
+		ttl = a.negativeTTL
+	}
+	if ttl > 0 {
+		a.put(&cacheEntry{
+			key:     key,
+			ok:      ok,
+			expires: time.Now().Add(ttl),
+			values:  rc.values,
+		})
+	}
+	return ok
+}
+
+func (a *cachingAuthenticator) key(req AuthenticateRequest) [sha256.Size]byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(req.User))
+	mac.Write([]byte{0})
+	mac.Write([]byte(req.Password))
+	mac.Write([]byte{0})
+	if req.PublicKey != nil {
+		mac.Write(req.PublicKey.Marshal())
+	}
+	var key [sha256.Size]byte
+	copy(key[:], mac.Sum(nil))
+	return key
+}
+
+func (a *cachingAuthenticator) get(key [sha256.Size]byte) (*cacheEntry, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	e, ok := a.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		a.lru.Remove(e)
+		delete(a.entries, key)
+		return nil, false
+	}
+	a.lru.MoveToFront(e)
+	return entry, true
+}
+
+func (a *cachingAuthenticator) put(entry *cacheEntry) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if e, ok := a.entries[entry.key]; ok {
+		e.Value = entry
+		a.lru.MoveToFront(e)
+		return
+	}
+	a.entries[entry.key] = a.lru.PushFront(entry)
+	for a.maxEntries > 0 && a.lru.Len() > a.maxEntries {
+		oldest := a.lru.Back()
+		a.lru.Remove(oldest)
+		delete(a.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// recordingContext 记录 inner 认证时写入的值，同时写入原始的 context
+type recordingContext struct {
+	context.Context
+	values []contextValue
+}
+
+func (c *recordingContext) SetValue(key, value any) {
+	c.values = append(c.values, contextValue{key, value})
+	if sc, ok := c.Context.(interface{ SetValue(key, value any) }); ok {
+		sc.SetValue(key, value)
+	}
+}
+
+func (c *recordingContext) Value(key any) any {
+	for i := len(c.values) - 1; i >= 0; i-- {
+		if c.values[i].key == key {
+			return c.values[i].value
+		}
+	}
+	return c.Context.Value(key)
+}
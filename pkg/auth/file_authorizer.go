@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gobwas/glob"
+	"gopkg.in/yaml.v3"
+)
+
+// ACLRule 对匹配 Users 的用户生效，Users 中 group: 开头的项匹配用户所在的组
+type ACLRule struct {
+	Users []string `json:"users" yaml:"users"`
+	Allow []string `json:"allow" yaml:"allow"`
+	Deny  []string `json:"deny" yaml:"deny"`
+}
+
+type ACL struct {
+	Rules []ACLRule `json:"rules" yaml:"rules"`
+}
+
+type aclRule struct {
+	users  []glob.Glob
+	groups []glob.Glob
+	allow  []TargetPattern
+	deny   []TargetPattern
+}
+
+func (r *aclRule) matchUser(user string, groups []string) bool {
+	for _, g := range r.users {
+		if g.Match(user) {
+			return true
+		}
+	}
+	for _, g := range r.groups {
+		for _, group := range groups {
+			if g.Match(group) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FileAuthorizer 从 YAML 或 JSON 文件加载访问规则，文件修改后自动重新加载
+// 所有匹配用户的规则中，任一 deny 命中即拒绝，否则需要有 allow 命中，默认拒绝
+func FileAuthorizer(path string) Authorizer {
+	file := newReloadingFile(path, parseACL)
+	return AuthorizeFunc(func(ctx context.Context, req AuthorizeRequest) bool {
+		rules, ok := file.Load()
+		if !ok {
+			return false
+		}
+		return authorizeACL(rules, req.User, GroupsFromContext(ctx), req.Target)
+	})
+}
+
+func authorizeACL(rules []*aclRule, user string, groups []string, target string) bool {
+	allowed := false
+	for _, r := range rules {
+		if !r.matchUser(user, groups) {
+			continue
+		}
+		for _, p := range r.deny {
+			if p.Match(target) {
+				return false
+			}
+		}
+		if !allowed {
+			for _, p := range r.allow {
+				if p.Match(target) {
+					allowed = true
+					break
+				}
+			}
+		}
+	}
+	return allowed
+}
+
+func parseACL(data []byte) ([]*aclRule, error) {
+	// JSON 是 YAML 的子集，两种格式都可以直接用 YAML 解析
+	var acl ACL
+	if err := yaml.Unmarshal(data, &acl); err != nil {
+		return nil, err
+	}
+
+	rules := make([]*aclRule, 0, len(acl.Rules))
+	for _, rule := range acl.Rules {
+		r := &aclRule{}
+		for _, u := range rule.Users {
+			list := &r.users
+			if group, ok := strings.CutPrefix(u, "group:"); ok {
+				u, list = group, &r.groups
+			}
+			g, err := glob.Compile(u)
+			if err != nil {
+				return nil, err
+			}
+			*list = append(*list, g)
+		}
+		for _, s := range rule.Allow {
+			p, err := ParseTargetPattern(s)
+			if err != nil {
+				return nil, err
+			}
+			r.allow = append(r.allow, p)
+		}
+		for _, s := range rule.Deny {
+			p, err := ParseTargetPattern(s)
+			if err != nil {
+				return nil, err
+			}
+			r.deny = append(r.deny, p)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
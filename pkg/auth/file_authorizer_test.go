@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestAuthorizeACLPrecedence(t *testing.T) {
+	rules, err := parseACL([]byte(`
+rules:
+  - users: ["*"]
+    allow: ["*.example.com:*"]
+    deny: ["admin.example.com:*"]
+  - users: ["alice"]
+    allow: ["admin.example.com:443", "10.0.0.0/8:8000-9000"]
+  - users: ["group:ops"]
+    allow: ["*.internal:*"]
+    deny: ["db.internal:5432"]
+  - users: ["bob"]
+    allow: ["db.internal:5432"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user   string
+		groups []string
+		target string
+		want   bool
+	}{
+		{"carol", nil, "www.example.com:443", true},
+		{"carol", nil, "WWW.Example.com:443", true},
+		// 任一匹配的规则 deny 命中时，其他规则的 allow 不生效
+		{"carol", nil, "admin.example.com:443", false},
+		{"alice", nil, "admin.example.com:443", false},
+		{"alice", nil, "10.1.2.3:8080", true},
+		{"alice", nil, "10.1.2.3:9001", false},
+		{"carol", nil, "10.1.2.3:8080", false},
+		{"dave", []string{"ops"}, "cache.internal:6379", true},
+		{"dave", []string{"ops"}, "db.internal:5432", false},
+		{"bob", []string{"ops"}, "db.internal:5432", false},
+		{"bob", nil, "db.internal:5432", true},
+		// 没有 allow 命中时默认拒绝
+		{"carol", nil, "www.example.org:443", false},
+	}
+	for _, tt := range tests {
+		if got := authorizeACL(rules, tt.user, tt.groups, tt.target); got != tt.want {
+			t.Errorf("authorizeACL(%v, %v, %v) = %v, want %v", tt.user, tt.groups, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reloadingFile 缓存文件解析结果，文件修改时间或大小变化时重新解析
+type reloadingFile[T any] struct {
+	path  string
+	parse func(data []byte) (T, error)
+
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	loaded  bool
+	value   T
+}
+
+func newReloadingFile[T any](path string, parse func(data []byte) (T, error)) *reloadingFile[T] {
+	return &reloadingFile[T]{
+		path:  path,
+		parse: parse,
+	}
+}
+
+func (f *reloadingFile[T]) Load() (T, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		logrus.Warnf("Failed to stat %v: %v", f.path, err)
+		var zero T
+		return zero, false
+	}
+	if f.loaded && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.value, true
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		logrus.Warnf("Failed to read %v: %v", f.path, err)
+		return f.value, f.loaded
+	}
+	value, err := f.parse(data)
+	if err != nil {
+		// 解析失败时继续使用上一次的结果
+		logrus.Warnf("Failed to parse %v: %v", f.path, err)
+		return f.value, f.loaded
+	}
+	if f.loaded {
+		logrus.Infof("Reloaded %v", f.path)
+	}
+	f.value = value
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	f.loaded = true
+	return f.value, true
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/subtle"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 未知用户时用于比对的 bcrypt 哈希，使其耗时与已知用户接近，避免通过响应时间枚举用户
+var dummyBcryptHash, _ = bcrypt.GenerateFromPassword([]byte("srp"), bcrypt.DefaultCost)
+
+// HtpasswdAuthenticator 使用 htpasswd 文件校验密码，支持 bcrypt 与 apr1 哈希，文件修改后自动重新加载
+func HtpasswdAuthenticator(path string) Authenticator {
+	file := newReloadingFile(path, parseHtpasswd)
+	return UserPasswordAuthenticator(UserPasswordFunc(func(ctx context.Context, user, password string) bool {
+		users, _ := file.Load()
+		hash, ok := users[user]
+		if !ok {
+			_ = bcrypt.CompareHashAndPassword(dummyBcryptHash, []byte(password))
+			return false
+		}
+		return checkHtpasswdHash(hash, password)
+	}))
+}
+
+func parseHtpasswd(data []byte) (map[string]string, error) {
+	ret := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewBuffer(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		ret[user] = hash
+	}
+	return ret, sc.Err()
+}
+
+func checkHtpasswdHash(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+
+	case strings.HasPrefix(hash, apr1Magic):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, apr1Magic), "$")
+		return subtle.ConstantTimeCompare([]byte(apr1(password, salt)), []byte(hash)) == 1
+	}
+	return false
+}
+
+const apr1Magic = "$apr1$"
+
+// apr1 实现 Apache 的 MD5 crypt 算法
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw, s := []byte(password), []byte(salt)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write(s)
+	alt.Write(pw)
+	final := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(apr1Magic))
+	d.Write(s)
+	for i := len(pw); i > 0; i -= 16 {
+		d.Write(final[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final = d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 != 0 {
+			d.Write(pw)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write(s)
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 != 0 {
+			d.Write(final)
+		} else {
+			d.Write(pw)
+		}
+		final = d.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var out strings.Builder
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(final[g[0]])<<16|uint32(final[g[1]])<<8|uint32(final[g[2]]), 4)
+	}
+	encode(uint32(final[11]), 2)
+	return apr1Magic + salt + "$" + out.String()
+}
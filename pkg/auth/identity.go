@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pigeonligh/srp/pkg/protocol"
+)
+
+// Identity 是认证阶段得到的身份信息，授权时通过 AuthorizeRequest.Identity 获取
+type Identity struct {
+	User   string
+	Groups []string
+	Claims map[string]any
+}
+
+// SetIdentity 由 Authenticator 在认证成功后调用，将 id 写入连接的 context
+func SetIdentity(ctx context.Context, id *Identity) {
+	if c, ok := ctx.(interface{ SetValue(key, value any) }); ok {
+		c.SetValue(protocol.ContextKeyIdentity, id)
+	}
+}
+
+// IdentityFromContext 返回 SetIdentity 写入的身份，未写入时根据 LDAP 用户组和 JWT claims 组合，都没有时返回 nil
+func IdentityFromContext(ctx context.Context) *Identity {
+	if id, ok := ctx.Value(protocol.ContextKeyIdentity).(*Identity); ok && id != nil {
+		return id
+	}
+
+	groups, _ := ctx.Value(protocol.ContextKeyGroups).([]string)
+	claims, _ := ctx.Value(protocol.ContextKeyJWTClaims).(jwt.MapClaims)
+	if groups == nil && claims == nil {
+		return nil
+	}
+	id := &Identity{Groups: groups, Claims: claims}
+	if u, ok := ctx.Value(protocol.ContextKeyUser).(string); ok {
+		id.User = u
+	} else if u, ok := ctx.Value(ssh.ContextKeyUser).(string); ok {
+		id.User = u
+	}
+	return id
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// 两次刷新 JWKS 之间的最小间隔，避免未知 kid 的请求频繁触发刷新
+var JWKSMinRefreshInterval = time.Minute
+
+type jwks struct {
+	url string
+	ttl time.Duration
+
+	// 同一时间只有一个请求在获取 JWKS，获取期间不持有 mutex
+	group singleflight.Group
+
+	mutex     sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+// JWKSKeyfunc 从 url 获取 JWKS 并按 kid 选择公钥，结果缓存 ttl，遇到未知 kid 时提前刷新
+func JWKSKeyfunc(url string, ttl time.Duration) jwt.Keyfunc {
+	s := &jwks{
+		url: url,
+		ttl: ttl,
+	}
+	return s.keyfunc
+}
+
+func (s *jwks) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, found, fetchedAt := s.lookup(kid)
+	expired := time.Since(fetchedAt) > s.ttl
+	if expired || (!found && time.Since(fetchedAt) > JWKSMinRefreshInterval) {
+		if _, err, _ := s.group.Do("", func() (any, error) { return nil, s.refresh() }); err != nil {
+			// 刷新失败时继续使用缓存的公钥
+			logrus.Warnf("Failed to fetch JWKS from %v: %v", s.url, err)
+		}
+		key, found, _ = s.lookup(kid)
+	}
+
+	if !found {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+func (s *jwks) lookup(kid string) (any, bool, time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key, ok := s.keys[kid]
+	return key, ok, s.fetchedAt
+}
+
+func (s *jwks) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			logrus.Warnf("Skip key %q in JWKS: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWKSKeyfuncFetchesOnce(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		fmt.Fprintf(w, `{"keys":[{"kty":"oct","kid":"k1","k":%q}]}`, base64.RawURLEncoding.EncodeToString([]byte("secret")))
+	}))
+	defer srv.Close()
+
+	keyfunc := JWKSKeyfunc(srv.URL, time.Hour)
+	token := &jwt.Token{Header: map[string]any{"kid": "k1"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := keyfunc(token); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("JWKS is fetched %v times, want 1", n)
+	}
+}
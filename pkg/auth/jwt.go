@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pigeonligh/srp/pkg/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+type JWTOptions struct {
+	// 允许的签名算法，例如 HS256、RS256、ES256，为空时不限制
+	Methods  []string
+	Audience string
+	Issuer   string
+	// 校验过期时间时允许的时钟偏差
+	Leeway time.Duration
+}
+
+// JWTAuthenticator 将密码字段作为 JWT 校验，要求 sub 与用户名一致且未过期
+// 校验通过后 claims 会写入 context，可以通过 JWTClaimsFromContext 读取
+func JWTAuthenticator(keyfunc jwt.Keyfunc, opts JWTOptions) Authenticator {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(opts.Leeway),
+	}
+	if len(opts.Methods) > 0 {
+		parserOptions = append(parserOptions, jwt.WithValidMethods(opts.Methods))
+	}
+	if opts.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(opts.Audience))
+	}
+	if opts.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(opts.Issuer))
+	}
+	parser := jwt.NewParser(parserOptions...)
+
+	return AuthenticateFunc(func(ctx context.Context, req AuthenticateRequest) bool {
+		if req.Password == "" {
+			return false
+		}
+		claims := jwt.MapClaims{}
+		if _, err := parser.ParseWithClaims(req.Password, claims, keyfunc); err != nil {
+			logrus.Debugf("Invalid token for %v: %v", req.User, err)
+			return false
+		}
+		if sub, _ := claims.GetSubject(); sub != req.User {
+			logrus.Debugf("Token subject %q does not match user %v", sub, req.User)
+			return false
+		}
+		if c, ok := ctx.(interface{ SetValue(key, value any) }); ok {
+			c.SetValue(protocol.ContextKeyJWTClaims, claims)
+		}
+		return true
+	})
+}
+
+func JWTClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(protocol.ContextKeyJWTClaims).(jwt.MapClaims)
+	return claims, ok
+}
+
+// StaticKeyfunc 使用固定的密钥校验签名，HMAC 使用 []byte，RSA/ECDSA 使用对应的公钥
+func StaticKeyfunc(key any) jwt.Keyfunc {
+	return func(*jwt.Token) (any, error) {
+		return key, nil
+	}
+}
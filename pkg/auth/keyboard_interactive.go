@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"net"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type KeyboardInteractiveRequest struct {
+	User       string
+	Challenge  gossh.KeyboardInteractiveChallenge
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+}
+
+// KeyboardInteractiveAuthenticator 通过 Challenge 向客户端发出提示并校验回答
+type KeyboardInteractiveAuthenticator interface {
+	AuthenticateKeyboardInteractive(context.Context, KeyboardInteractiveRequest) bool
+}
+
+type KeyboardInteractiveFunc func(context.Context, KeyboardInteractiveRequest) bool
+
+func (f KeyboardInteractiveFunc) AuthenticateKeyboardInteractive(ctx context.Context, req KeyboardInteractiveRequest) bool {
+	return f(ctx, req)
+}
+
+var _ KeyboardInteractiveAuthenticator = KeyboardInteractiveFunc(nil)
+
+// PromptAuthenticator 依次发出 prompts，全部回答通过 check 校验时认证成功
+func PromptAuthenticator(prompts []string, echos []bool, check func(ctx context.Context, user string, answers []string) bool) KeyboardInteractiveAuthenticator {
+	return KeyboardInteractiveFunc(func(ctx context.Context, req KeyboardInteractiveRequest) bool {
+		answers, err := req.Challenge(req.User, "", prompts, echos)
+		if err != nil || len(answers) != len(prompts) {
+			return false
+		}
+		return check(ctx, req.User, answers)
+	})
+}
+
+// PasswordTOTPAuthenticator 先要求密码再要求 TOTP 验证码，密码由 password 校验，
+// secrets 返回用户的 base32 TOTP 密钥
+func PasswordTOTPAuthenticator(password Authenticator, secrets func(user string) (string, bool)) KeyboardInteractiveAuthenticator {
+	return KeyboardInteractiveFunc(func(ctx context.Context, req KeyboardInteractiveRequest) bool {
+		answers, err := req.Challenge(req.User, "", []string{"Password: "}, []bool{false})
+		if err != nil || len(answers) != 1 {
+			return false
+		}
+		if !password.Authenticate(ctx, AuthenticateRequest{
+			User:       req.User,
+			Password:   answers[0],
+			RemoteAddr: req.RemoteAddr,
+			LocalAddr:  req.LocalAddr,
+		}) {
+			return false
+		}
+
+		answers, err = req.Challenge(req.User, "", []string{"Verification code: "}, []bool{true})
+		if err != nil || len(answers) != 1 {
+			return false
+		}
+		secret, ok := secrets(req.User)
+		return ok && ValidateTOTP(secret, answers[0])
+	})
+}
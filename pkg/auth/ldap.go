@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/pigeonligh/srp/pkg/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+type LDAPConfig struct {
+	// 例如 ldap://ldap.example.com:389 或 ldaps://ldap.example.com:636
+	URL string
+	// 用户 DN 模板，%s 会被替换为转义后的用户名，例如 uid=%s,ou=people,dc=example,dc=com
+	BindDNTemplate string
+	BaseDN         string
+
+	// 查询用户所在组的过滤器，%s 会被替换为用户 DN，例如 (member=%s)，为空时不查询
+	GroupFilter string
+	// 组名所在的属性，默认为 cn
+	GroupAttribute string
+
+	StartTLS  bool
+	TLSConfig *tls.Config
+
+	// 单次绑定的超时时间，context 带有更早的截止时间时以 context 为准
+	Timeout      time.Duration
+	MaxIdleConns int
+}
+
+var DefaultLDAPTimeout = 10 * time.Second
+
+type ldapAuthenticator struct {
+	config LDAPConfig
+	idle   chan *ldap.Conn
+}
+
+// LDAPAuthenticator 使用用户名和密码绑定 LDAP 完成认证，连接会被复用
+// 配置了 GroupFilter 时，用户所在的组会写入 context，可以通过 GroupsFromContext 读取
+func LDAPAuthenticator(config LDAPConfig) Authenticator {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultLDAPTimeout
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "cn"
+	}
+	if config.MaxIdleConns <= 0 {
+		config.MaxIdleConns = 4
+	}
+	return &ldapAuthenticator{
+		config: config,
+		idle:   make(chan *ldap.Conn, config.MaxIdleConns),
+	}
+}
+
+func (a *ldapAuthenticator) Authenticate(ctx context.Context, req AuthenticateRequest) bool {
+	// 空密码会被 LDAP 当作匿名绑定
+	if req.User == "" || req.Password == "" {
+		return false
+	}
+	dn := fmt.Sprintf(a.config.BindDNTemplate, ldap.EscapeDN(req.User))
+
+	// 复用的连接可能已经被服务端断开，失败时换新连接重试一次
+	for retry := 0; retry < 2; retry++ {
+		conn, err := a.get(ctx, retry > 0)
+		if err != nil {
+			logrus.Warnf("Failed to connect to LDAP %v: %v", a.config.URL, err)
+			return false
+		}
+		conn.SetTimeout(a.timeout(ctx))
+
+		groups, err := a.bind(conn, dn, req.Password)
+		if err == nil {
+			a.put(conn)
+			if c, ok := ctx.(interface{ SetValue(key, value any) }); ok && groups != nil {
+				c.SetValue(protocol.ContextKeyGroups, groups)
+			}
+			return true
+		}
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			a.put(conn)
+			return false
+		}
+		_ = conn.Close()
+		if !ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+			logrus.Warnf("LDAP bind for %v failed: %v", req.User, err)
+			return false
+		}
+	}
+	return false
+}
+
+func (a *ldapAuthenticator) bind(conn *ldap.Conn, dn, password string) ([]string, error) {
+	if err := conn.Bind(dn, password); err != nil {
+		return nil, err
+	}
+	if a.config.GroupFilter == "" {
+		return nil, nil
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(a.config.GroupFilter, ldap.EscapeFilter(dn)),
+		[]string{a.config.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		if g := entry.GetAttributeValue(a.config.GroupAttribute); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+func (a *ldapAuthenticator) timeout(ctx context.Context) time.Duration {
+	timeout := a.config.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	return max(timeout, time.Millisecond)
+}
+
+func (a *ldapAuthenticator) get(ctx context.Context, fresh bool) (*ldap.Conn, error) {
+	for !fresh {
+		select {
+		case conn := <-a.idle:
+			if !conn.IsClosing() {
+				return conn, nil
+			}
+			_ = conn.Close()
+			continue
+
+		default:
+		}
+		break
+	}
+
+	dialer := &net.Dialer{Timeout: a.timeout(ctx)}
+	conn, err := ldap.DialURL(a.config.URL,
+		ldap.DialWithDialer(dialer),
+		ldap.DialWithTLSConfig(a.config.TLSConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if a.config.StartTLS && !strings.HasPrefix(a.config.URL, "ldaps://") {
+		tlsConfig := a.config.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			if u, err := url.Parse(a.config.URL); err == nil {
+				tlsConfig = tlsConfig.Clone()
+				tlsConfig.ServerName = u.Hostname()
+			}
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (a *ldapAuthenticator) put(conn *ldap.Conn) {
+	select {
+	case a.idle <- conn:
+	default:
+		_ = conn.Close()
+	}
+}
+
+// GroupsFromContext 返回认证时写入 context 的用户组
+func GroupsFromContext(ctx context.Context) []string {
+	if groups, ok := ctx.Value(protocol.ContextKeyGroups).([]string); ok {
+		return groups
+	}
+	if id, ok := ctx.Value(protocol.ContextKeyIdentity).(*Identity); ok && id != nil {
+		return id.Groups
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+)
+
+// PatternRule 匹配主机与端口，Hosts 为空时匹配所有主机，Ports 为空时匹配所有端口
+type PatternRule struct {
+	Hosts []HostMatcher
+	Ports []PortRange
+	Deny  bool
+}
+
+func (r PatternRule) match(host string, port uint16) bool {
+	hostMatched := len(r.Hosts) == 0
+	for _, h := range r.Hosts {
+		if h.MatchHost(host) {
+			hostMatched = true
+			break
+		}
+	}
+	if !hostMatched {
+		return false
+	}
+	if len(r.Ports) == 0 {
+		return true
+	}
+	for _, p := range r.Ports {
+		if p.MatchPort(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// PatternAuthorizer 依次检查规则，命中 deny 规则时立即拒绝，否则需要命中至少一条 allow 规则
+type PatternAuthorizer []PatternRule
+
+func (rules PatternAuthorizer) Authorize(ctx context.Context, req AuthorizeRequest) bool {
+	host, port, ok := splitTarget(req.Target)
+	if !ok {
+		return false
+	}
+	allowed := false
+	for _, r := range rules {
+		if !r.match(host, port) {
+			continue
+		}
+		if r.Deny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+var _ Authorizer = PatternAuthorizer(nil)
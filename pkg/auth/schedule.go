@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow 表示一天中允许的时间段，End 早于 Start 时表示跨过午夜
+type TimeWindow struct {
+	// 为空时每天生效，跨午夜的时间段以开始的那一天为准
+	Weekdays []time.Weekday
+	Start    time.Duration
+	End      time.Duration
+}
+
+func (w TimeWindow) contains(t time.Time) bool {
+	// 使用墙上时间而不是距离午夜经过的时间，夏令时切换的当天时间段不会偏移
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.Start <= w.End {
+		return w.onDay(t.Weekday()) && offset >= w.Start && offset < w.End
+	}
+	// 跨午夜：当天 Start 之后，或前一天开始的时间段在今天 End 之前
+	return (w.onDay(t.Weekday()) && offset >= w.Start) ||
+		(w.onDay((t.Weekday()+6)%7) && offset < w.End)
+}
+
+func (w TimeWindow) onDay(day time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseTimeWindow 解析形如 "Mon-Fri 09:00-18:00"、"Sat,Sun 10:00-12:00" 或 "22:00-06:00" 的时间段
+func ParseTimeWindow(s string) (TimeWindow, error) {
+	var w TimeWindow
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return w, fmt.Errorf("invalid time window %q", s)
+	}
+
+	if len(fields) == 2 {
+		for _, part := range strings.Split(fields[0], ",") {
+			from, to, isRange := strings.Cut(strings.ToLower(part), "-")
+			f, ok1 := weekdays[from]
+			t, ok2 := weekdays[to]
+			if !isRange {
+				t, ok2 = f, ok1
+			}
+			if !ok1 || !ok2 {
+				return w, fmt.Errorf("invalid weekdays %q", fields[0])
+			}
+			for d := f; ; d = (d + 1) % 7 {
+				w.Weekdays = append(w.Weekdays, d)
+				if d == t {
+					break
+				}
+			}
+		}
+	}
+
+	start, end, found := strings.Cut(fields[len(fields)-1], "-")
+	if !found {
+		return w, fmt.Errorf("invalid time range %q", s)
+	}
+	var err error
+	if w.Start, err = parseClock(start); err != nil {
+		return w, err
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return w, err
+	}
+	return w, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		if s == "24:00" {
+			return 24 * time.Hour, nil
+		}
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+type Schedule struct {
+	// 为空时使用本地时区
+	Location *time.Location
+	Users    map[string][]TimeWindow
+	Groups   map[string][]TimeWindow
+	// 为空时使用 time.Now，可以在测试中替换
+	Clock func() time.Time
+}
+
+// ScheduleAuthorizer 限制用户只能在指定的时间段内使用转发，时间段内再交给 inner 判断
+// 用户及其所在的组都没有配置时间段时不受限制
+func ScheduleAuthorizer(inner Authorizer, schedule Schedule) Authorizer {
+	if schedule.Location == nil {
+		schedule.Location = time.Local
+	}
+	if schedule.Clock == nil {
+		schedule.Clock = time.Now
+	}
+	return AuthorizeFunc(func(ctx context.Context, req AuthorizeRequest) bool {
+		windows := append([]TimeWindow{}, schedule.Users[req.User]...)
+		for _, group := range GroupsFromContext(ctx) {
+			windows = append(windows, schedule.Groups[group]...)
+		}
+		if len(windows) > 0 {
+			now := schedule.Clock().In(schedule.Location)
+			permitted := false
+			for _, w := range windows {
+				if w.contains(now) {
+					permitted = true
+					break
+				}
+			}
+			if !permitted {
+				return false
+			}
+		}
+		return inner.Authorize(ctx, req)
+	})
+}
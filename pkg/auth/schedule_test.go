@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindowContains(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	work, err := ParseTimeWindow("Mon-Fri 09:00-18:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	night, err := ParseTimeWindow("22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		window TimeWindow
+		t      time.Time
+		want   bool
+	}{
+		{work, time.Date(2024, 3, 6, 9, 0, 0, 0, loc), true},
+		{work, time.Date(2024, 3, 6, 17, 59, 0, 0, loc), true},
+		{work, time.Date(2024, 3, 6, 18, 0, 0, 0, loc), false},
+		{work, time.Date(2024, 3, 9, 10, 0, 0, 0, loc), false},
+		// 2024-03-10 和 2024-11-03 是夏令时切换的日期
+		{night, time.Date(2024, 3, 10, 22, 30, 0, 0, loc), true},
+		{night, time.Date(2024, 3, 10, 21, 30, 0, 0, loc), false},
+		{night, time.Date(2024, 3, 10, 5, 30, 0, 0, loc), true},
+		{night, time.Date(2024, 3, 10, 6, 30, 0, 0, loc), false},
+		{night, time.Date(2024, 11, 3, 21, 30, 0, 0, loc), false},
+		{night, time.Date(2024, 11, 3, 22, 0, 0, 0, loc), true},
+		{night, time.Date(2024, 11, 3, 6, 0, 0, 0, loc), false},
+	}
+	for _, tt := range tests {
+		if got := tt.window.contains(tt.t); got != tt.want {
+			t.Errorf("%+v contains %v = %v, want %v", tt.window, tt.t, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// HostMatcher 匹配目标的主机部分
+type HostMatcher interface {
+	MatchHost(host string) bool
+}
+
+type HostGlob struct {
+	glob.Glob
+}
+
+func (g HostGlob) MatchHost(host string) bool {
+	return g.Match(host)
+}
+
+type HostRegexp struct {
+	*regexp.Regexp
+}
+
+func (r HostRegexp) MatchHost(host string) bool {
+	return r.MatchString(host)
+}
+
+type HostPrefix netip.Prefix
+
+func (p HostPrefix) MatchHost(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	return err == nil && netip.Prefix(p).Contains(addr.Unmap())
+}
+
+// PortRange 表示闭区间 [From, To]
+type PortRange struct {
+	From uint16
+	To   uint16
+}
+
+var AnyPort = PortRange{From: 0, To: 65535}
+
+func (r PortRange) MatchPort(port uint16) bool {
+	return port >= r.From && port <= r.To
+}
+
+// TargetPattern 匹配 host:port 形式的目标
+type TargetPattern struct {
+	Host HostMatcher
+	Port PortRange
+}
+
+func (p TargetPattern) Match(target string) bool {
+	host, port, ok := splitTarget(target)
+	return ok && p.Host.MatchHost(host) && p.Port.MatchPort(port)
+}
+
+// ParseTargetPattern 解析目标规则，主机部分可以是 glob 或 CIDR，端口部分可以是 *、单个端口或 from-to 的范围
+// 例如 *.example.com:443、10.0.0.0/8:8000-9000、[fd00::/8]:*，省略端口时匹配所有端口
+func ParseTargetPattern(s string) (TargetPattern, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		host, port = strings.Trim(s, "[]"), "*"
+	}
+
+	h, err := ParseHostMatcher(host)
+	if err != nil {
+		return TargetPattern{}, err
+	}
+	r, err := ParsePortRange(port)
+	if err != nil {
+		return TargetPattern{}, err
+	}
+	return TargetPattern{Host: h, Port: r}, nil
+}
+
+func ParseHostMatcher(s string) (HostMatcher, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", s, err)
+		}
+		return HostPrefix(prefix.Masked()), nil
+	}
+	g, err := glob.Compile(strings.ToLower(s), '.')
+	if err != nil {
+		return nil, fmt.Errorf("invalid host pattern %q: %w", s, err)
+	}
+	return HostGlob{g}, nil
+}
+
+func ParsePortRange(s string) (PortRange, error) {
+	if s == "*" || s == "" {
+		return AnyPort, nil
+	}
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		to = from
+	}
+	f, err := strconv.ParseUint(from, 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port %q", s)
+	}
+	t, err := strconv.ParseUint(to, 10, 16)
+	if err != nil || t < f {
+		return PortRange{}, fmt.Errorf("invalid port %q", s)
+	}
+	return PortRange{From: uint16(f), To: uint16(t)}, nil
+}
+
+func splitTarget(target string) (string, uint16, bool) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", 0, false
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.ToLower(host), uint16(p), true
+}
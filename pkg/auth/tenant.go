@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TenantMapper 返回用户所属租户的命名空间，如 "acme"，用户不属于任何租户时返回 false
+type TenantMapper interface {
+	Tenant(ctx context.Context, user string) (string, bool)
+}
+
+type TenantMapperFunc func(ctx context.Context, user string) (string, bool)
+
+func (f TenantMapperFunc) Tenant(ctx context.Context, user string) (string, bool) {
+	return f(ctx, user)
+}
+
+// StaticTenants 为用户名到命名空间的映射
+type StaticTenants map[string]string
+
+func (m StaticTenants) Tenant(ctx context.Context, user string) (string, bool) {
+	ns, ok := m[user]
+	return ns, ok && ns != ""
+}
+
+// FileTenants 从 YAML 或 JSON 文件加载用户名到命名空间的映射，文件修改后自动重新加载
+func FileTenants(path string) TenantMapper {
+	file := newReloadingFile(path, func(data []byte) (StaticTenants, error) {
+		var m StaticTenants
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	})
+	return TenantMapperFunc(func(ctx context.Context, user string) (string, bool) {
+		m, ok := file.Load()
+		if !ok {
+			return "", false
+		}
+		return m.Tenant(ctx, user)
+	})
+}
+
+// GroupTenants 使用认证时得到的第一个以 prefix 开头的用户组作为命名空间，如 prefix 为 "tenant:" 时组 "tenant:acme" 对应 "acme"
+func GroupTenants(prefix string) TenantMapper {
+	return TenantMapperFunc(func(ctx context.Context, user string) (string, bool) {
+		for _, group := range GroupsFromContext(ctx) {
+			if ns, ok := strings.CutPrefix(group, prefix); ok && ns != "" {
+				return ns, true
+			}
+		}
+		return "", false
+	})
+}
+
+// InTenant 判断 host 是否位于命名空间 ns 下，即等于 ns 或以 "ns." 开头，不区分大小写
+// IP 地址不属于任何命名空间，否则名为 10 的租户可以访问 10.0.0.0/8
+func InTenant(host, ns string) bool {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return false
+	}
+	host, ns = strings.ToLower(host), strings.ToLower(ns)
+	return ns != "" && (host == ns || strings.HasPrefix(host, ns+"."))
+}
+
+// TenantAuthorizer 只允许用户访问所属租户命名空间下的目标，不属于任何租户的用户全部拒绝，
+// 需要自动为目标加上命名空间时使用 proxy.TenantResolver
+func TenantAuthorizer(m TenantMapper) Authorizer {
+	return AuthorizeFunc(func(ctx context.Context, req AuthorizeRequest) bool {
+		ns, ok := m.Tenant(ctx, req.User)
+		if !ok {
+			return false
+		}
+		host, _, err := net.SplitHostPort(req.Target)
+		if err != nil {
+			return false
+		}
+		return InTenant(host, ns)
+	})
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTenantAuthorizer(t *testing.T) {
+	authorizer := TenantAuthorizer(StaticTenants{
+		"alice": "acme",
+		"bob":   "other",
+		"carol": "10",
+	})
+
+	tests := []struct {
+		user   string
+		target string
+		want   bool
+	}{
+		{"alice", "acme:80", true},
+		{"alice", "web.acme:80", false},
+		{"alice", "acme.web:80", true},
+		{"alice", "acme.db.internal:5432", true},
+		// 跨租户访问
+		{"alice", "other.web:80", false},
+		{"bob", "acme.web:80", false},
+		{"alice", "acmecorp.web:80", false},
+		// 大小写不敏感
+		{"alice", "ACME.Web:80", true},
+		{"alice", "Other.web:80", false},
+		// IP 地址不属于任何租户
+		{"carol", "10.0.0.1:22", false},
+		{"carol", "10:22", true},
+		{"carol", "10.web:80", true},
+		{"alice", "[::1]:22", false},
+		{"dave", "acme.web:80", false},
+		{"alice", "acme.web", false},
+	}
+	for _, tt := range tests {
+		got := authorizer.Authorize(context.Background(), AuthorizeRequest{User: tt.user, Target: tt.target})
+		if got != tt.want {
+			t.Errorf("Authorize(%q, %q) = %v, want %v", tt.user, tt.target, got, tt.want)
+		}
+	}
+}
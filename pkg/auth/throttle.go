@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ThrottleOptions struct {
+	// 在 Window 内失败 MaxFailures 次后封禁 BanDuration
+	MaxFailures int
+	Window      time.Duration
+	BanDuration time.Duration
+	// 同时按用户名统计失败次数
+	ByUser bool
+}
+
+var DefaultThrottleOptions = ThrottleOptions{
+	MaxFailures: 5,
+	Window:      time.Minute,
+	BanDuration: 10 * time.Minute,
+}
+
+type throttleEntry struct {
+	failures    []time.Time
+	bannedUntil time.Time
+}
+
+type ThrottledAuthenticator struct {
+	inner Authenticator
+	opts  ThrottleOptions
+
+	mutex     sync.Mutex
+	entries   map[string]*throttleEntry
+	lastSweep time.Time
+}
+
+// ThrottleAuthenticator 统计每个来源 IP（以及可选的用户名）的认证失败次数，超过阈值后在封禁期内直接拒绝
+func ThrottleAuthenticator(inner Authenticator, opts ThrottleOptions) *ThrottledAuthenticator {
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = DefaultThrottleOptions.MaxFailures
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultThrottleOptions.Window
+	}
+	if opts.BanDuration <= 0 {
+		opts.BanDuration = DefaultThrottleOptions.BanDuration
+	}
+	return &ThrottledAuthenticator{
+		inner:   inner,
+		opts:    opts,
+		entries: make(map[string]*throttleEntry),
+	}
+}
+
+var _ Authenticator = (*ThrottledAuthenticator)(nil)
+
+func (a *ThrottledAuthenticator) Authenticate(ctx context.Context, req AuthenticateRequest) bool {
+	keys := a.keys(req)
+	if a.banned(keys) {
+		logrus.Debugf("Reject authentication for %v from %v: banned", req.User, req.RemoteAddr)
+		return false
+	}
+
+	ok := a.inner.Authenticate(ctx, req)
+	if !ok {
+		a.fail(keys)
+	}
+	return ok
+}
+
+// Bans 返回当前被封禁的来源及解封时间
+func (a *ThrottledAuthenticator) Bans() map[string]time.Time {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	ret := make(map[string]time.Time)
+	for key, e := range a.entries {
+		if e.bannedUntil.After(now) {
+			ret[key] = e.bannedUntil
+		}
+	}
+	return ret
+}
+
+func (a *ThrottledAuthenticator) keys(req AuthenticateRequest) []string {
+	keys := make([]string, 0, 2)
+	if req.RemoteAddr != nil {
+		host, _, err := net.SplitHostPort(req.RemoteAddr.String())
+		if err != nil {
+			host = req.RemoteAddr.String()
+		}
+		keys = append(keys, "ip:"+host)
+	}
+	if a.opts.ByUser {
+		keys = append(keys, "user:"+req.User)
+	}
+	return keys
+}
+
+func (a *ThrottledAuthenticator) banned(keys []string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		if e, ok := a.entries[key]; ok && e.bannedUntil.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ThrottledAuthenticator) fail(keys []string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	a.sweep(now)
+	for _, key := range keys {
+		e, ok := a.entries[key]
+		if !ok {
+			e = &throttleEntry{}
+			a.entries[key] = e
+		}
+		e.failures = append(recentFailures(e.failures, now.Add(-a.opts.Window)), now)
+		if len(e.failures) >= a.opts.MaxFailures {
+			e.bannedUntil = now.Add(a.opts.BanDuration)
+			e.failures = nil
+			logrus.Warnf("Too many authentication failures from %v, banned until %v", key, e.bannedUntil)
+		}
+	}
+}
+
+// sweep 清理已过期的记录，避免无限增长
+func (a *ThrottledAuthenticator) sweep(now time.Time) {
+	if now.Sub(a.lastSweep) < a.opts.Window {
+		return
+	}
+	a.lastSweep = now
+	for key, e := range a.entries {
+		e.failures = recentFailures(e.failures, now.Add(-a.opts.Window))
+		if len(e.failures) == 0 && !e.bannedUntil.After(now) {
+			delete(a.entries, key)
+		}
+	}
+}
+
+func recentFailures(failures []time.Time, since time.Time) []time.Time {
+	for i, t := range failures {
+		if t.After(since) {
+			return failures[i:]
+		}
+	}
+	return failures[:0]
+}
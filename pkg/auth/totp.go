@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	DefaultTOTPPeriod = 30 * time.Second
+	DefaultTOTPDigits = 6
+	// DefaultTOTPSkew 为允许的时钟偏差，以 period 为单位
+	DefaultTOTPSkew = 1
+)
+
+// ValidateTOTP 按 RFC 6238 校验 code，secret 为 base32 编码
+func ValidateTOTP(secret, code string) bool {
+	return validateTOTP(secret, code, time.Now())
+}
+
+func validateTOTP(secret, code string, now time.Time) bool {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(
+		strings.TrimRight(strings.ToUpper(strings.ReplaceAll(secret, " ", "")), "="),
+	)
+	if err != nil || len(code) != DefaultTOTPDigits {
+		return false
+	}
+	counter := now.Unix() / int64(DefaultTOTPPeriod/time.Second)
+	for i := -DefaultTOTPSkew; i <= DefaultTOTPSkew; i++ {
+		want := hotp(key, uint64(counter+int64(i)), DefaultTOTPDigits)
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func hotp(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
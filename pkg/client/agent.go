@@ -0,0 +1,19 @@
+package client
+
+import (
+	"errors"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var ErrAgentNotFound = errors.New("ssh agent not found")
+
+func AgentAuthMethod() (gossh.AuthMethod, error) {
+	conn, err := dialAgent()
+	if err != nil {
+		return nil, err
+	}
+	agentClient := agent.NewClient(conn)
+	return gossh.PublicKeysCallback(agentClient.Signers), nil
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+func dialAgent() (io.ReadWriter, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("%w: SSH_AUTH_SOCK is not set", ErrAgentNotFound)
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAgentNotFound, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const windowsAgentPipe = `\\.\pipe\openssh-ssh-agent`
+
+func dialAgent() (io.ReadWriter, error) {
+	pipe := os.Getenv("SSH_AUTH_SOCK")
+	if pipe == "" {
+		pipe = windowsAgentPipe
+	}
+	f, err := os.OpenFile(pipe, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAgentNotFound, err)
+	}
+	return f, nil
+}
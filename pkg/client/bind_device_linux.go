@@ -0,0 +1,18 @@
+//go:build linux
+
+package client
+
+import "syscall"
+
+// bindDeviceControl 通过 SO_BINDTODEVICE 将 socket 绑定到 device，通常需要 CAP_NET_RAW
+func bindDeviceControl(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = syscall.BindToDevice(int(fd), device)
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+}
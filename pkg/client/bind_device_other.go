@@ -0,0 +1,15 @@
+//go:build !linux
+
+package client
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+func bindDeviceControl(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return fmt.Errorf("binding to device %v is not supported on %v", device, runtime.GOOS)
+	}
+}
@@ -2,11 +2,17 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
 	"sync"
+	"time"
 
+	"github.com/pigeonligh/srp/pkg/clock"
 	"github.com/pigeonligh/srp/pkg/nets"
+	"github.com/sirupsen/logrus"
 	gossh "golang.org/x/crypto/ssh"
 )
 
@@ -15,8 +21,9 @@ type Connection interface {
 }
 
 type sshConnection struct {
-	config ConnConfig
-	dialer nets.SSHDialer
+	config   ConnConfig
+	dialer   nets.SSHDialer
+	channels channelCounter
 }
 
 func NewSSHConnection(config ConnConfig, dialer nets.SSHDialer) Connection {
@@ -26,12 +33,39 @@ func NewSSHConnection(config ConnConfig, dialer nets.SSHDialer) Connection {
 	}
 }
 
+func (c *sshConnection) ChannelStats() ChannelStats {
+	return c.channels.stats()
+}
+
+func (c *sshConnection) hostKeyCallback() (gossh.HostKeyCallback, error) {
+	if c.config.HostKeyCallback != nil {
+		return c.config.HostKeyCallback, nil
+	}
+	if c.config.KnownHostsPath != "" {
+		return KnownHostsCallback(c.config.KnownHostsPath, c.config.KnownHostsTOFU)
+	}
+	return insecureHostKeyCallback(), nil
+}
+
 func (c *sshConnection) Run(ctx context.Context) error {
+	proxies, err := expandProxies(c.config.Proxies)
+	if err != nil {
+		return err
+	}
+	if err := c.config.Algorithms.Validate(); err != nil {
+		return err
+	}
+	hostKeyCallback, err := c.hostKeyCallback()
+	if err != nil {
+		return err
+	}
 	config := &gossh.ClientConfig{
 		User:            c.config.User,
 		Auth:            c.config.AuthMethods,
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         c.config.DialTimeout,
 	}
+	c.config.Algorithms.Apply(&config.Config)
 
 	client, err := c.dialer.DialContext(ctx, c.config.Network, c.config.Address, config)
 	if err != nil {
@@ -44,21 +78,86 @@ func (c *sshConnection) Run(ctx context.Context) error {
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
-	defer func() {
-		_ = client.Close()
+	defer c.releaseClient(client)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// client 可能由 SSHDialer 在多个连接间共享，转发在 Run 结束或 client 断开时都会停止
+	disconnected := make(chan struct{})
+	var disconnectErr error
+	go func() {
+		disconnectErr = client.Wait()
+		close(disconnected)
 	}()
+	wait := func() error {
+		select {
+		case <-disconnected:
+			return disconnectErr
+		case <-ctx.Done():
+			return nil
+		}
+	}
 
-	for _, proxy := range c.config.Proxies {
+	if c.config.KeepAliveInterval > 0 {
 		wg.Add(1)
-		go func(proxy ProxyConfig) {
+		go func() {
 			defer wg.Done()
 
-			if err := handleSSHProxy(client, proxy); err != nil {
+			if err := keepAlive(ctx, clock.Or(c.config.Clock), client, c.config.KeepAliveInterval, c.config.KeepAliveMaxCount); err != nil {
+				// 连接已经不可用，关闭后共享该连接的 SSHDialer 会重新拨号
+				_ = client.Close()
 				select {
 				case errCh <- err:
 				default:
 				}
 			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		select {
+		case <-disconnected:
+			select {
+			case errCh <- fmt.Errorf("connection closed: %v", disconnectErr):
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+	}()
+
+	var failedMutex sync.Mutex
+	var failed []error
+	for _, proxy := range proxies {
+		wg.Add(1)
+		go func(proxy ProxyConfig) {
+			defer wg.Done()
+
+			err := c.handleSSHProxy(client, proxy, wait)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+			err = fmt.Errorf("%v: %w", proxy, err)
+			if c.config.OnForwardError != nil {
+				c.config.OnForwardError(proxy, err)
+			} else {
+				logrus.Warnf("Forward failed: %v", err)
+			}
+
+			// 一个转发失败不影响其他转发，全部失败时才结束连接
+			failedMutex.Lock()
+			failed = append(failed, err)
+			allFailed := len(failed) == len(proxies)
+			failedMutex.Unlock()
+			if allFailed {
+				select {
+				case errCh <- errors.Join(failed...):
+				case <-ctx.Done():
+				}
+			}
 		}(proxy)
 	}
 
@@ -71,60 +170,253 @@ func (c *sshConnection) Run(ctx context.Context) error {
 	}
 }
 
-func handleSSHProxy(client *gossh.Client, proxy ProxyConfig) error {
+// releaseClient 在 Run 结束时释放 client，SSHDialer 复用连接时由它决定是否关闭
+func (c *sshConnection) releaseClient(client *gossh.Client) {
+	if r, ok := c.dialer.(nets.SSHClientReleaser); ok {
+		_ = r.Release(client)
+		return
+	}
+	_ = client.Close()
+}
+
+func (c *sshConnection) transferFunc(target string) func(net.Conn, int64, int64) {
+	if c.config.OnTransfer == nil {
+		return nil
+	}
+	return func(conn net.Conn, rx, tx int64) {
+		c.config.OnTransfer(fmt.Sprintf("%v->%v", conn.RemoteAddr(), target), rx, tx)
+	}
+}
+
+// handleSSHProxy 处理一个转发，wait 返回时停止转发
+func (c *sshConnection) handleSSHProxy(client *gossh.Client, proxy ProxyConfig, wait func() error) error {
+	if proxy.LocalSocket != "" {
+		if proxy.Type != LocalForward {
+			return fmt.Errorf("local socket %v is only supported for local forward", proxy.LocalSocket)
+		}
+		if proxy.LocalHost != "" || proxy.LocalPort != "" {
+			return fmt.Errorf("local socket %v: local host/port must be empty", proxy.LocalSocket)
+		}
+	}
+
 	switch proxy.Type {
 	case DynamicForward:
-		return fmt.Errorf("TODO")
+		socks := c.socksServer(client, proxy)
+		opts := c.forwardOptions("socks")
+		opts.listen = c.reportListen(proxy, func() (net.Listener, error) {
+			return listenConfig(proxy).Listen(context.Background(), proxy.Network, net.JoinHostPort(proxy.LocalHost, proxy.LocalPort))
+		})
+		opts.dial = func(conn net.Conn) (net.Conn, error) {
+			ret, err := socks.Negotiate(context.Background(), conn)
+			if err != nil {
+				logrus.Warnf("SOCKS negotiation with %v failed: %v", conn.RemoteAddr(), err)
+			}
+			return ret, err
+		}
+		opts.wait = wait
+		return handleForward(opts)
 
 	case LocalForward:
-		return handleForward(
-			func() (net.Listener, error) {
-				return net.Listen(proxy.Network, net.JoinHostPort(proxy.LocalHost, proxy.LocalPort))
-			},
-			func(net.Conn) (net.Conn, error) {
-				network := proxy.Network
-				address := net.JoinHostPort(proxy.RemoteHost, proxy.RemotePort)
-				return client.Dial(network, address)
-			},
-			client.Wait,
-			func(err error) {},
-		)
+		hasHostPort := proxy.RemoteHost != "" || proxy.RemotePort != ""
+		if hasHostPort == (proxy.RemoteSocket != "") {
+			return fmt.Errorf("local forward on %v: exactly one of remote host/port or remote socket is required",
+				net.JoinHostPort(proxy.LocalHost, proxy.LocalPort))
+		}
+		if isPacketNetwork(proxy.Network) {
+			if proxy.RemoteSocket != "" || proxy.LocalSocket != "" {
+				return fmt.Errorf("unix socket is not supported for %v forward", proxy.Network)
+			}
+			return handleUDPForward(client, wait, clock.Or(c.config.Clock), proxy, &c.channels, func(addr net.Addr) {
+				c.listened(proxy, addr)
+			})
+		}
+
+		network, address := proxy.Network, net.JoinHostPort(proxy.RemoteHost, proxy.RemotePort)
+		if proxy.RemoteSocket != "" {
+			network, address = "unix", proxy.RemoteSocket
+		}
+		opts := c.forwardOptions(address)
+		opts.listen = c.reportListen(proxy, func() (net.Listener, error) {
+			if proxy.LocalSocket != "" {
+				if proxy.BindDevice != "" {
+					return nil, fmt.Errorf("bind device is not supported for unix socket %v", proxy.LocalSocket)
+				}
+				return listenLocalSocket(proxy.LocalSocket)
+			}
+			return listenConfig(proxy).Listen(context.Background(), proxy.Network, net.JoinHostPort(proxy.LocalHost, proxy.LocalPort))
+		})
+		opts.dial = func(net.Conn) (net.Conn, error) {
+			conn, err := client.Dial(network, address)
+			if err != nil {
+				return nil, err
+			}
+			return c.channels.conn(conn, address), nil
+		}
+		opts.wait = wait
+		return handleForward(opts)
 
 	case RemoteForward:
-		return handleForward(
-			func() (net.Listener, error) {
-				return client.ListenUnix(fmt.Sprintf("/%v/%v", proxy.RemoteHost, proxy.RemotePort))
-			},
-			func(c net.Conn) (net.Conn, error) {
-				network := proxy.Network
-				address := net.JoinHostPort(proxy.LocalHost, proxy.LocalPort)
-				return net.Dial(network, address)
-			},
-			nil,
-			func(err error) {},
-		)
+		if proxy.RemotePort == "0" {
+			// streamlocal-forward 由 gossh 发送，拿不到服务端回复中分配的端口，OnListen 无法报告实际端口
+			return fmt.Errorf("remote forward on %v: port 0 is not supported", proxy.RemoteHost)
+		}
+		local := net.JoinHostPort(proxy.LocalHost, proxy.LocalPort)
+		opts := c.forwardOptions(local)
+		opts.listen = c.reportListen(proxy, func() (net.Listener, error) {
+			l, err := client.ListenUnix(fmt.Sprintf("/%v/%v", proxy.RemoteHost, proxy.RemotePort))
+			if err != nil {
+				return nil, err
+			}
+			return c.channels.listener(l, local), nil
+		})
+		opts.dial = func(net.Conn) (net.Conn, error) {
+			return net.Dial(proxy.Network, local)
+		}
+		opts.wait = wait
+		return handleForward(opts)
 	}
 
 	return fmt.Errorf("unknown proxy type")
 }
 
-func handleForward(
-	listen func() (net.Listener, error),
-	dial func(net.Conn) (net.Conn, error),
-	errFunc func() error,
-	errLogger func(error),
-) error {
-	l, err := listen()
+// reportListen 在 listen 成功后通过 OnListen 上报实际的监听地址
+func (c *sshConnection) reportListen(proxy ProxyConfig, listen func() (net.Listener, error)) func() (net.Listener, error) {
+	return func() (net.Listener, error) {
+		l, err := listen()
+		if err == nil {
+			c.listened(proxy, l.Addr())
+		}
+		return l, err
+	}
+}
+
+func (c *sshConnection) listened(proxy ProxyConfig, addr net.Addr) {
+	if c.config.OnListen != nil {
+		c.config.OnListen(proxy, addr)
+	}
+}
+
+func (c *sshConnection) socksServer(client *gossh.Client, proxy ProxyConfig) *nets.SOCKS5Server {
+	commands := proxy.SOCKSCommands
+	if len(commands) == 0 {
+		commands = []nets.SOCKS5Command{nets.SOCKS5Connect}
+	}
+	s := &nets.SOCKS5Server{
+		Auth:             proxy.SOCKSAuth,
+		HandshakeTimeout: proxy.SOCKSHandshakeTimeout,
+	}
+	for _, cmd := range commands {
+		switch cmd {
+		case nets.SOCKS5Connect:
+			s.Dial = func(ctx context.Context, addr string) (net.Conn, error) {
+				conn, err := client.DialContext(ctx, "tcp", addr)
+				if err != nil {
+					return nil, err
+				}
+				return c.channels.conn(conn, addr), nil
+			}
+		case nets.SOCKS5UDPAssociate:
+			s.DialUDP = func(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+				ch, err := openUDPChannel(client, addr, nil)
+				if err != nil {
+					return nil, err
+				}
+				return c.channels.channel(ch, addr), nil
+			}
+		}
+	}
+	return s
+}
+
+// listenConfig 返回本地监听使用的 ListenConfig，设置了 BindDevice 时绑定到对应的网卡
+func listenConfig(proxy ProxyConfig) *net.ListenConfig {
+	lc := &net.ListenConfig{}
+	if proxy.BindDevice != "" {
+		lc.Control = bindDeviceControl(proxy.BindDevice)
+	}
+	return lc
+}
+
+// listenLocalSocket 删除残留的 socket 文件后监听，listener 关闭时会自动删除 socket 文件
+func listenLocalSocket(path string) (net.Listener, error) {
+	if stat, err := os.Lstat(path); err == nil {
+		if stat.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%v exists and is not a socket", path)
+		}
+		if c, err := net.Dial("unix", path); err == nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("%v is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(true)
+	return l, nil
+}
+
+func isPacketNetwork(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return true
+	}
+	return false
+}
+
+// forwardOptions 为 handleForward 的参数，除 listen 和 dial 外都可以为空
+type forwardOptions struct {
+	listen func() (net.Listener, error)
+	dial   func(net.Conn) (net.Conn, error)
+	// wait 返回时关闭监听和已经建立的连接并结束转发，为空时在 Accept 出错后结束
+	wait       func() error
+	onError    func(error)
+	onTransfer func(c net.Conn, rx, tx int64)
+
+	limit       int
+	idleTimeout time.Duration
+	bufferSize  int
+	clock       clock.Clock
+}
+
+func (c *sshConnection) forwardOptions(target string) forwardOptions {
+	return forwardOptions{
+		onTransfer:  c.transferFunc(target),
+		limit:       c.config.MaxConnectionsPerForward,
+		idleTimeout: c.config.IdleTimeout,
+		bufferSize:  c.config.CopyBufferSize,
+		clock:       c.config.Clock,
+	}
+}
+
+func handleForward(opts forwardOptions) error {
+	l, err := opts.listen()
 	if err != nil {
 		return err
 	}
 
+	// 关闭 l 时同时结束 ctx，让等待连接数配额的 Accept 立即返回
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	errCh := make(chan error)
 
-	if errFunc != nil {
+	// 返回前等待已经建立的连接处理结束
+	var inflight sync.WaitGroup
+	served := make(chan struct{})
+	defer func() {
+		<-served
+		inflight.Wait()
+	}()
+
+	if opts.wait != nil {
 		go func() {
-			err := errFunc()
+			err := opts.wait()
 			_ = l.Close()
+			cancel()
 			errCh <- err
 		}()
 	} else {
@@ -134,25 +426,51 @@ func handleForward(
 	}
 
 	go func() {
-		err := nets.HandleListener(l, func(c net.Conn) {
-			conn, err := dial(c)
+		defer close(served)
+		err := nets.HandleListenerContext(ctx, l, func(c net.Conn) {
+			conn, err := opts.dial(c)
 			if err != nil {
-				if errLogger != nil {
-					errLogger(err)
+				if opts.onError != nil {
+					opts.onError(err)
 				}
 				return
 			}
+			// dial 已经自行处理了 c，如 SOCKS5 的 UDP ASSOCIATE
+			if conn == nil {
+				return
+			}
 			defer func() {
 				_ = conn.Close()
 			}()
+			// 转发停止时关闭已经建立的连接，client 被共享时不会因为 Run 结束而断开
+			stop := context.AfterFunc(ctx, func() {
+				_ = c.Close()
+				_ = conn.Close()
+			})
+			defer stop()
 
-			if err := nets.HandleConnections(c, conn); err != nil {
-				if errLogger != nil {
-					errLogger(err)
+			cc := nets.NewCountingConn(c)
+			var rwc io.ReadWriteCloser = cc
+			if opts.idleTimeout > 0 {
+				// 超过 idleTimeout 没有数据时同时关闭两端，避免另一个方向的拷贝一直阻塞
+				ic := nets.NewIdleConnWithClock(cc, opts.clock, opts.idleTimeout, func(time.Duration, time.Duration) {
+					_ = c.Close()
+					_ = conn.Close()
+				})
+				defer ic.Stop()
+				rwc = ic
+			}
+			if err := nets.HandleConnectionsBuffer(rwc, conn, opts.bufferSize); err != nil {
+				if opts.onError != nil {
+					opts.onError(err)
 				}
 			}
-		})
-		if errFunc == nil {
+			if opts.onTransfer != nil {
+				rx, tx := cc.Transferred()
+				opts.onTransfer(c, rx, tx)
+			}
+		}, nets.WithTracker(&inflight), nets.WithConcurrencyLimit(opts.limit))
+		if opts.wait == nil {
 			errCh <- err
 		}
 	}()
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleSSHProxyLocalSocketExclusive(t *testing.T) {
+	c := &sshConnection{}
+	tests := []ProxyConfig{
+		{Type: LocalForward, Network: "tcp", LocalSocket: "/tmp/x.sock", LocalHost: "127.0.0.1", RemoteHost: "example.com", RemotePort: "80"},
+		{Type: LocalForward, Network: "tcp", LocalSocket: "/tmp/x.sock", LocalPort: "8080", RemoteHost: "example.com", RemotePort: "80"},
+		{Type: DynamicForward, Network: "tcp", LocalSocket: "/tmp/x.sock"},
+	}
+	for _, proxy := range tests {
+		err := c.handleSSHProxy(nil, proxy, nil)
+		if err == nil || !strings.Contains(err.Error(), "local socket") {
+			t.Errorf("handleSSHProxy(%+v) = %v, want local socket error", proxy, err)
+		}
+	}
+}
+
+func TestHandleSSHProxyRemoteForwardPortZero(t *testing.T) {
+	c := &sshConnection{}
+	proxy := ProxyConfig{Type: RemoteForward, Network: "tcp", LocalHost: "127.0.0.1", LocalPort: "8080", RemoteHost: "web", RemotePort: "0"}
+	if err := c.handleSSHProxy(nil, proxy, nil); err == nil || !strings.Contains(err.Error(), "port 0") {
+		t.Fatalf("handleSSHProxy(%+v) = %v, want port 0 error", proxy, err)
+	}
+}
+
+func TestHandleForwardClosesConnectionsOnWait(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- handleForward(forwardOptions{
+			listen: func() (net.Listener, error) { return l, nil },
+			dial: func(net.Conn) (net.Conn, error) {
+				// 模拟共享 client 上的 channel，Run 结束时不会被关闭
+				local, _ := net.Pipe()
+				return local, nil
+			},
+			wait: func() error {
+				<-stop
+				return nil
+			},
+		})
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	close(stop)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handleForward does not return after wait")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Read() = %v, want EOF", err)
+	}
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type PortPair struct {
+	LocalPort  string
+	RemotePort string
+}
+
+// expandProxies 将带有 Ports 或端口范围（如 8000-8010）的配置展开为多个单端口的配置
+func expandProxies(proxies []ProxyConfig) ([]ProxyConfig, error) {
+	ret := make([]ProxyConfig, 0, len(proxies))
+	for _, proxy := range proxies {
+		pairs := proxy.Ports
+		if len(pairs) == 0 {
+			pairs = []PortPair{{LocalPort: proxy.LocalPort, RemotePort: proxy.RemotePort}}
+		}
+		for _, pair := range pairs {
+			expanded, err := expandPortPair(pair)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range expanded {
+				c := proxy
+				c.Ports = nil
+				c.LocalPort, c.RemotePort = p.LocalPort, p.RemotePort
+				ret = append(ret, c)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func expandPortPair(pair PortPair) ([]PortPair, error) {
+	localFrom, localTo, localRange, err := parsePortRange(pair.LocalPort)
+	if err != nil {
+		return nil, err
+	}
+	remoteFrom, remoteTo, remoteRange, err := parsePortRange(pair.RemotePort)
+	if err != nil {
+		return nil, err
+	}
+	if !localRange && !remoteRange {
+		return []PortPair{pair}, nil
+	}
+	if !localRange || !remoteRange || localTo-localFrom != remoteTo-remoteFrom {
+		return nil, fmt.Errorf("port ranges %q and %q do not match", pair.LocalPort, pair.RemotePort)
+	}
+
+	ret := make([]PortPair, 0, localTo-localFrom+1)
+	for i := 0; i <= localTo-localFrom; i++ {
+		ret = append(ret, PortPair{
+			LocalPort:  strconv.Itoa(localFrom + i),
+			RemotePort: strconv.Itoa(remoteFrom + i),
+		})
+	}
+	return ret, nil
+}
+
+func parsePortRange(s string) (int, int, bool, error) {
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+	f, err1 := strconv.ParseUint(from, 10, 16)
+	t, err2 := strconv.ParseUint(to, 10, 16)
+	if err1 != nil || err2 != nil || t < f {
+		return 0, 0, false, fmt.Errorf("invalid port range %q", s)
+	}
+	return int(f), int(t), true, nil
+}
+
+func (p ProxyConfig) String() string {
+	local := p.LocalSocket
+	if local == "" {
+		local = p.LocalHost + ":" + p.LocalPort
+	}
+	remote := p.RemoteSocket
+	if remote == "" {
+		remote = p.RemoteHost + ":" + p.RemotePort
+	}
+	switch p.Type {
+	case LocalForward:
+		return fmt.Sprintf("local forward %v -> %v", local, remote)
+	case RemoteForward:
+		return fmt.Sprintf("remote forward %v -> %v", remote, local)
+	}
+	return fmt.Sprintf("dynamic forward %v", local)
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrNotPrivateKey   = errors.New("not a private key")
+	ErrBadPassphrase   = errors.New("bad passphrase")
+	ErrPassphraseEmpty = errors.New("private key is encrypted but no passphrase is given")
+)
+
+// PrivateKeyAuthMethod 读取 PEM 或 OpenSSH 格式的私钥，passphrase 为空时私钥不能是加密的
+func PrivateKeyAuthMethod(path string, passphrase []byte) (gossh.AuthMethod, error) {
+	signer, err := loadPrivateKey(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return gossh.PublicKeys(signer), nil
+}
+
+// PrivateKeysAuthMethod 加载多个私钥，认证时依次尝试，无法加载的私钥会被跳过，但至少需要成功加载一个
+func PrivateKeysAuthMethod(paths []string, passphrase []byte) (gossh.AuthMethod, error) {
+	signers := make([]gossh.Signer, 0, len(paths))
+	var errs []error
+	for _, path := range paths {
+		signer, err := loadPrivateKey(path, passphrase)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no private key is loaded: %w", errors.Join(errs...))
+	}
+	return gossh.PublicKeys(signers...), nil
+}
+
+func loadPrivateKey(path string, passphrase []byte) (gossh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var signer gossh.Signer
+	if len(passphrase) == 0 {
+		signer, err = gossh.ParsePrivateKey(data)
+	} else {
+		signer, err = gossh.ParsePrivateKeyWithPassphrase(data, passphrase)
+	}
+	if err != nil && len(passphrase) > 0 && !errors.Is(err, x509.IncorrectPasswordError) {
+		// 未加密的私钥忽略 passphrase
+		if s, err2 := gossh.ParsePrivateKey(data); err2 == nil {
+			signer, err = s, nil
+		}
+	}
+	if err == nil {
+		return signer, nil
+	}
+
+	var missingErr *gossh.PassphraseMissingError
+	switch {
+	case errors.As(err, &missingErr):
+		err = ErrPassphraseEmpty
+	case errors.Is(err, x509.IncorrectPasswordError):
+		err = ErrBadPassphrase
+	default:
+		err = fmt.Errorf("%w: %v", ErrNotPrivateKey, err)
+	}
+	return nil, fmt.Errorf("load private key %v: %w", path, err)
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/clock"
+	"github.com/pigeonligh/srp/pkg/protocol"
+	"github.com/sirupsen/logrus"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var DefaultKeepAliveMaxCount = 3
+
+func keepAlive(ctx context.Context, clk clock.Clock, client *gossh.Client, interval time.Duration, maxCount int) error {
+	if maxCount <= 0 {
+		maxCount = DefaultKeepAliveMaxCount
+	}
+
+	t := clk.NewTicker(interval)
+	defer t.Stop()
+
+	failed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-t.C():
+		}
+
+		err := sendKeepAlive(clk, client, interval)
+		if err == nil {
+			failed = 0
+			continue
+		}
+
+		failed++
+		logrus.Warnf("Keepalive to %v failed (%v/%v): %v", client.RemoteAddr(), failed, maxCount, err)
+		if failed >= maxCount {
+			return fmt.Errorf("keepalive failed %v times: %w", failed, err)
+		}
+	}
+}
+
+func sendKeepAlive(clk clock.Clock, client *gossh.Client, timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		// 服务端不认识该请求时会回复失败，同样说明连接是活跃的
+		_, _, err := client.SendRequest(protocol.KeepAliveRequestType, true, nil)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+
+	case <-clk.After(timeout):
+		return fmt.Errorf("no reply in %v", timeout)
+	}
+}
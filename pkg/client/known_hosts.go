@@ -0,0 +1,71 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var insecureHostKeyWarning sync.Once
+
+func insecureHostKeyCallback() gossh.HostKeyCallback {
+	insecureHostKeyWarning.Do(func() {
+		logrus.Warnln("Host key verification is disabled, set HostKeyCallback or KnownHostsPath to pin server keys.")
+	})
+	return gossh.InsecureIgnoreHostKey()
+}
+
+// KnownHostsCallback 使用 OpenSSH 格式的 known_hosts 文件校验 host key，
+// tofu 为 true 时信任文件中还没有记录的主机，并将其 key 追加到文件中
+func KnownHostsCallback(path string, tofu bool) (gossh.HostKeyCallback, error) {
+	if tofu {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open known hosts: %w", err)
+		}
+		_ = f.Close()
+	}
+	if _, err := knownhosts.New(path); err != nil {
+		return nil, fmt.Errorf("load known hosts: %w", err)
+	}
+
+	var mutex sync.Mutex
+	return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// 每次都重新加载，以便 TOFU 追加的记录能立即生效
+		callback, err := knownhosts.New(path)
+		if err != nil {
+			return fmt.Errorf("load known hosts: %w", err)
+		}
+		err = callback(hostname, remote, key)
+
+		var keyErr *knownhosts.KeyError
+		if !tofu || !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err
+		}
+		logrus.Warnf("Permanently added %v to known hosts %v.", hostname, path)
+		return appendKnownHost(path, hostname, key)
+	}, nil
+}
+
+func appendKnownHost(path string, hostname string, key gossh.PublicKey) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open known hosts: %w", err)
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("append known hosts: %w", err)
+	}
+	return nil
+}
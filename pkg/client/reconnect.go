@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/clock"
+	"github.com/sirupsen/logrus"
+)
+
+type ReconnectPolicy struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// 连接保持超过 ResetAfter 后，退避时间恢复为 InitialBackoff
+	ResetAfter time.Duration
+
+	// Clock 用于退避的计时，为空时使用 clock.Real
+	Clock clock.Clock
+}
+
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	ResetAfter:     time.Minute,
+}
+
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultReconnectPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultReconnectPolicy.MaxBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.ResetAfter <= 0 {
+		p.ResetAfter = DefaultReconnectPolicy.ResetAfter
+	}
+	p.Clock = clock.Or(p.Clock)
+	return p
+}
+
+type reconnectingConnection struct {
+	conn   Connection
+	policy ReconnectPolicy
+}
+
+func ReconnectingConnection(conn Connection, policy ReconnectPolicy) Connection {
+	return &reconnectingConnection{
+		conn:   conn,
+		policy: policy.withDefaults(),
+	}
+}
+
+func (c *reconnectingConnection) ChannelStats() ChannelStats {
+	if r, ok := c.conn.(ChannelStatsReporter); ok {
+		return r.ChannelStats()
+	}
+	return ChannelStats{Targets: make(map[string]int64)}
+}
+
+func (c *reconnectingConnection) Run(ctx context.Context) error {
+	backoff := c.policy.InitialBackoff
+	for {
+		start := c.policy.Clock.Now()
+		err := c.conn.Run(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if c.policy.Clock.Now().Sub(start) >= c.policy.ResetAfter {
+			backoff = c.policy.InitialBackoff
+		}
+		logrus.Warnf("Connection lost: %v, reconnecting in %v", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-c.policy.Clock.After(backoff):
+		}
+		backoff = min(backoff*2, c.policy.MaxBackoff)
+	}
+}
@@ -0,0 +1,225 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ConfigFromSSHConfig 从 OpenSSH 的 ssh_config 文件中读取 hostAlias 对应的配置，
+// 支持 Host、HostName、Port、User、IdentityFile、LocalForward、RemoteForward 和 DynamicForward，
+// 与 OpenSSH 相同，单值的选项以第一个匹配到的为准，其他选项会被忽略
+func ConfigFromSSHConfig(path, hostAlias string) (ConnConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ConnConfig{}, err
+	}
+	defer f.Close()
+
+	var hostName, port, userName string
+	var identityFiles []string
+	config := ConnConfig{Network: "tcp"}
+
+	matched := true
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		keyword, args := splitSSHConfigLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+		if keyword == "host" {
+			matched = matchSSHHost(args, hostAlias)
+			continue
+		}
+		if keyword == "match" {
+			logrus.Warnf("%v:%v: Match is not supported, the block is ignored", path, line)
+			matched = false
+			continue
+		}
+		if !matched {
+			continue
+		}
+		if len(args) == 0 {
+			return ConnConfig{}, fmt.Errorf("%v:%v: missing argument for %v", path, line, keyword)
+		}
+
+		switch keyword {
+		case "hostname":
+			if hostName == "" {
+				hostName = args[0]
+			}
+		case "port":
+			if port == "" {
+				port = args[0]
+			}
+		case "user":
+			if userName == "" {
+				userName = args[0]
+			}
+		case "identityfile":
+			identityFiles = append(identityFiles, args[0])
+		case "localforward", "remoteforward", "dynamicforward":
+			proxy, err := parseSSHForward(keyword, args)
+			if err != nil {
+				return ConnConfig{}, fmt.Errorf("%v:%v: %w", path, line, err)
+			}
+			config.Proxies = append(config.Proxies, proxy)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ConnConfig{}, err
+	}
+
+	if hostName == "" {
+		hostName = hostAlias
+	}
+	hostName = strings.ReplaceAll(hostName, "%h", hostAlias)
+	if port == "" {
+		port = "22"
+	}
+	if userName == "" {
+		if u, err := user.Current(); err == nil {
+			userName = u.Username
+		}
+	}
+	config.Address = net.JoinHostPort(hostName, port)
+	config.User = userName
+
+	signers := make([]gossh.Signer, 0, len(identityFiles))
+	for _, file := range identityFiles {
+		file = expandSSHPath(file, hostName, userName)
+		signer, err := loadPrivateKey(file, nil)
+		if err != nil {
+			logrus.Warnf("Skip identity file %v: %v", file, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		config.AuthMethods = append(config.AuthMethods, gossh.PublicKeys(signers...))
+	}
+	return config, nil
+}
+
+// splitSSHConfigLine 返回小写的关键字和参数，支持 "Keyword value" 和 "Keyword=value" 两种形式
+func splitSSHConfigLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil
+	}
+	keyword, rest := line, ""
+	if i := strings.IndexAny(line, " \t="); i >= 0 {
+		keyword, rest = line[:i], strings.TrimSpace(line[i:])
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+	}
+
+	var args []string
+	for _, field := range strings.Fields(rest) {
+		if strings.HasPrefix(field, "#") {
+			break
+		}
+		args = append(args, strings.Trim(field, `"`))
+	}
+	return strings.ToLower(keyword), args
+}
+
+// matchSSHHost 判断 alias 是否匹配 Host 的模式列表，任一取反的模式匹配时不匹配
+func matchSSHHost(patterns []string, alias string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		ok, _ := path.Match(strings.TrimPrefix(pattern, "!"), alias)
+		if ok && negated {
+			return false
+		}
+		matched = matched || ok
+	}
+	return matched
+}
+
+func expandSSHPath(p, host, userName string) string {
+	home, _ := os.UserHomeDir()
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		p = filepath.Join(home, p[1:])
+	}
+	return strings.NewReplacer("%d", home, "%h", host, "%r", userName, "%u", userName, "%%", "%").Replace(p)
+}
+
+func parseSSHForward(keyword string, args []string) (ProxyConfig, error) {
+	listenHost, listenPort, listenSocket, err := splitSSHForwardAddr(args[0], "localhost")
+	if err != nil {
+		return ProxyConfig{}, err
+	}
+	if keyword == "dynamicforward" {
+		if listenSocket != "" {
+			return ProxyConfig{}, fmt.Errorf("unix socket is not supported for DynamicForward")
+		}
+		return ProxyConfig{Type: DynamicForward, Network: "tcp", LocalHost: listenHost, LocalPort: listenPort}, nil
+	}
+
+	if len(args) < 2 {
+		return ProxyConfig{}, fmt.Errorf("missing target for %v", keyword)
+	}
+	targetHost, targetPort, targetSocket, err := splitSSHForwardAddr(args[1], "")
+	if err != nil {
+		return ProxyConfig{}, err
+	}
+
+	if keyword == "localforward" {
+		return ProxyConfig{
+			Type:         LocalForward,
+			Network:      "tcp",
+			LocalHost:    listenHost,
+			LocalPort:    listenPort,
+			LocalSocket:  listenSocket,
+			RemoteHost:   targetHost,
+			RemotePort:   targetPort,
+			RemoteSocket: targetSocket,
+		}, nil
+	}
+	if listenSocket != "" || targetSocket != "" {
+		return ProxyConfig{}, fmt.Errorf("unix socket is not supported for RemoteForward")
+	}
+	if listenHost == "" {
+		// 与服务端处理 tcpip-forward 时相同，监听所有地址的 * 视为 localhost
+		listenHost = "localhost"
+	}
+	return ProxyConfig{
+		Type:       RemoteForward,
+		Network:    "tcp",
+		RemoteHost: listenHost,
+		RemotePort: listenPort,
+		LocalHost:  targetHost,
+		LocalPort:  targetPort,
+	}, nil
+}
+
+// splitSSHForwardAddr 解析 [host:]port 或 unix socket 路径，省略 host 时使用 defaultHost
+func splitSSHForwardAddr(s, defaultHost string) (string, string, string, error) {
+	if strings.HasPrefix(s, "/") {
+		return "", "", s, nil
+	}
+	if !strings.Contains(s, ":") {
+		return defaultHost, s, "", nil
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid forward address %q: %w", s, err)
+	}
+	switch host {
+	case "":
+		host = defaultHost
+	case "*":
+		// 监听所有地址
+		host = ""
+	}
+	return host, port, "", nil
+}
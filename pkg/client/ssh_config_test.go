@@ -0,0 +1,40 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestParseSSHForward(t *testing.T) {
+	tests := []struct {
+		keyword string
+		args    []string
+		want    ProxyConfig
+		wantErr bool
+	}{
+		{"remoteforward", []string{"8080", "localhost:80"}, ProxyConfig{Type: RemoteForward, Network: "tcp", RemoteHost: "localhost", RemotePort: "8080", LocalHost: "localhost", LocalPort: "80"}, false},
+		// * 表示服务端的所有地址，需要得到服务端可以接受的 host
+		{"remoteforward", []string{"*:8080", "localhost:80"}, ProxyConfig{Type: RemoteForward, Network: "tcp", RemoteHost: "localhost", RemotePort: "8080", LocalHost: "localhost", LocalPort: "80"}, false},
+		{"remoteforward", []string{":8080", "localhost:80"}, ProxyConfig{Type: RemoteForward, Network: "tcp", RemoteHost: "localhost", RemotePort: "8080", LocalHost: "localhost", LocalPort: "80"}, false},
+		{"remoteforward", []string{"web:8080", "127.0.0.1:80"}, ProxyConfig{Type: RemoteForward, Network: "tcp", RemoteHost: "web", RemotePort: "8080", LocalHost: "127.0.0.1", LocalPort: "80"}, false},
+		{"remoteforward", []string{"/tmp/x.sock", "localhost:80"}, ProxyConfig{}, true},
+		{"localforward", []string{"*:8080", "web:80"}, ProxyConfig{Type: LocalForward, Network: "tcp", LocalHost: "", LocalPort: "8080", RemoteHost: "web", RemotePort: "80"}, false},
+		{"dynamicforward", []string{"1080"}, ProxyConfig{Type: DynamicForward, Network: "tcp", LocalHost: "localhost", LocalPort: "1080"}, false},
+		{"localforward", []string{"8080"}, ProxyConfig{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSSHForward(tt.keyword, tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSSHForward(%v, %q) error = %v, wantErr %v", tt.keyword, tt.args, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !equalProxyConfig(got, tt.want) {
+			t.Errorf("parseSSHForward(%v, %q) = %+v, want %+v", tt.keyword, tt.args, got, tt.want)
+		}
+	}
+}
+
+func equalProxyConfig(a, b ProxyConfig) bool {
+	return a.Type == b.Type && a.Network == b.Network &&
+		a.LocalHost == b.LocalHost && a.LocalPort == b.LocalPort && a.LocalSocket == b.LocalSocket &&
+		a.RemoteHost == b.RemoteHost && a.RemotePort == b.RemotePort && a.RemoteSocket == b.RemoteSocket
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pigeonligh/srp/pkg/nets"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ChannelStats 为一个 SSH 连接上转发使用的 channel 的统计，Targets 为每个目标当前打开的 channel 数
+type ChannelStats struct {
+	Open    int64
+	Opened  int64
+	Targets map[string]int64
+}
+
+// ChannelStatsReporter 由 NewSSHConnection 和 ReconnectingConnection 返回的 Connection 实现，
+// 重连后统计继续累计
+type ChannelStatsReporter interface {
+	ChannelStats() ChannelStats
+}
+
+type channelCounter struct {
+	open   atomic.Int64
+	opened atomic.Int64
+
+	mutex   sync.Mutex
+	targets map[string]int64 // 计数为 0 的目标会被删除
+}
+
+func (c *channelCounter) stats() ChannelStats {
+	ret := ChannelStats{
+		Open:   c.open.Load(),
+		Opened: c.opened.Load(),
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ret.Targets = make(map[string]int64, len(c.targets))
+	for target, n := range c.targets {
+		ret.Targets[target] = n
+	}
+	return ret
+}
+
+// track 记录一个新打开的 channel，返回的函数在 channel 关闭时调用，多次调用只生效一次
+func (c *channelCounter) track(target string) func() {
+	c.mutex.Lock()
+	if c.targets == nil {
+		c.targets = make(map[string]int64)
+	}
+	c.targets[target]++
+	c.mutex.Unlock()
+	c.open.Add(1)
+	c.opened.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			if c.targets[target]--; c.targets[target] <= 0 {
+				delete(c.targets, target)
+			}
+			c.mutex.Unlock()
+			c.open.Add(-1)
+		})
+	}
+}
+
+func (c *channelCounter) conn(conn net.Conn, target string) net.Conn {
+	return &trackedConn{Conn: conn, done: c.track(target)}
+}
+
+func (c *channelCounter) channel(ch gossh.Channel, target string) gossh.Channel {
+	return &trackedChannel{Channel: ch, done: c.track(target)}
+}
+
+// listener 统计从 l 接受的连接，用于服务端打开的 forwarded channel
+func (c *channelCounter) listener(l net.Listener, target string) net.Listener {
+	return &trackedListener{Listener: l, c: c, target: target}
+}
+
+type trackedConn struct {
+	net.Conn
+	done func()
+}
+
+func (c *trackedConn) Close() error {
+	c.done()
+	return c.Conn.Close()
+}
+
+func (c *trackedConn) CloseWrite() error {
+	nets.ConnCloseWrite(c.Conn)
+	return nil
+}
+
+type trackedChannel struct {
+	gossh.Channel
+	done func()
+}
+
+func (c *trackedChannel) Close() error {
+	c.done()
+	return c.Channel.Close()
+}
+
+type trackedListener struct {
+	net.Listener
+	c      *channelCounter
+	target string
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.c.conn(conn, l.target), nil
+}
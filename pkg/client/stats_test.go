@@ -0,0 +1,28 @@
+package client
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestChannelCounterDropsClosedTargets(t *testing.T) {
+	var c channelCounter
+	for i := 0; i < 100; i++ {
+		c.track("host-" + strconv.Itoa(i) + ":80")()
+	}
+	done := c.track("web:80")
+	c.track("web:80")()
+
+	stats := c.stats()
+	if stats.Open != 1 || stats.Opened != 102 {
+		t.Fatalf("open = %v, opened = %v, want 1 and 102", stats.Open, stats.Opened)
+	}
+	if len(stats.Targets) != 1 || stats.Targets["web:80"] != 1 {
+		t.Fatalf("targets = %v, want only web:80", stats.Targets)
+	}
+	done()
+	done()
+	if n := len(c.targets); n != 0 {
+		t.Fatalf("%v targets are kept after all channels are closed", n)
+	}
+}
@@ -1,6 +1,13 @@
 package client
 
-import gossh "golang.org/x/crypto/ssh"
+import (
+	"net"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/clock"
+	"github.com/pigeonligh/srp/pkg/nets"
+	gossh "golang.org/x/crypto/ssh"
+)
 
 type ProxyType int
 
@@ -16,7 +23,26 @@ type ProxyConfig struct {
 	LocalHost  string
 	LocalPort  string
 	RemoteHost string
+	// RemotePort 用于 RemoteForward 时不能为 0，客户端无法得知服务端分配的端口
 	RemotePort string
+	// BindDevice 不为空时本地监听只接受来自该网卡（如 eth1）的连接，通过 SO_BINDTODEVICE 实现，仅支持 Linux，
+	// 用于 LocalHost 无法区分网卡的多网卡主机，不能用于 unix socket
+	BindDevice string
+	// LocalSocket 为本地监听的 unix socket 路径，仅用于 LocalForward，与 LocalHost/LocalPort 互斥
+	LocalSocket string
+	// RemoteSocket 为服务端的 unix socket 路径，仅用于 LocalForward，与 RemoteHost/RemotePort 互斥
+	RemoteSocket string
+
+	// SOCKSCommands 为 DynamicForward 支持的 SOCKS5 命令，为空时只支持 CONNECT
+	SOCKSCommands []nets.SOCKS5Command
+	// SOCKSAuth 不为空时 DynamicForward 要求本地的 SOCKS5 客户端使用该用户名密码认证
+	SOCKSAuth *nets.Auth
+	// SOCKSHandshakeTimeout 限制本地 SOCKS5 客户端完成握手的时间，为 0 时使用 nets.DefaultSOCKS5HandshakeTimeout
+	SOCKSHandshakeTimeout time.Duration
+
+	// Ports 不为空时忽略 LocalPort/RemotePort，每一对端口展开为一个转发
+	// LocalPort/RemotePort 也可以是长度相同的端口范围，如 8000-8010
+	Ports []PortPair
 }
 
 type ConnConfig struct {
@@ -25,4 +51,42 @@ type ConnConfig struct {
 	User        string
 	AuthMethods []gossh.AuthMethod
 	Proxies     []ProxyConfig
+
+	// 未设置 HostKeyCallback 和 KnownHostsPath 时不校验服务端 host key
+	HostKeyCallback gossh.HostKeyCallback
+	KnownHostsPath  string
+	KnownHostsTOFU  bool
+
+	// Algorithms 限制协商使用的加密、MAC 和密钥交换算法，Run 时校验算法名称
+	Algorithms nets.SSHAlgorithms
+
+	// DialTimeout 限制建立连接和 SSH 握手的总时间，为 0 时不限制
+	DialTimeout time.Duration
+
+	// KeepAliveInterval 为 0 时不发送 keepalive
+	KeepAliveInterval time.Duration
+	KeepAliveMaxCount int
+
+	// IdleTimeout 为转发连接两个方向都没有数据的最长时间，超时后关闭连接，为 0 时不限制
+	IdleTimeout time.Duration
+
+	// CopyBufferSize 为转发连接时每个方向的缓冲区大小，为 0 时使用 nets.DefaultCopyBufferSize
+	CopyBufferSize int
+
+	// MaxConnectionsPerForward 限制每个转发同时处理的连接数，为 0 时不限制
+	MaxConnectionsPerForward int
+
+	// OnForwardError 在单个转发失败（如监听失败）时调用，其他转发不受影响，为空时只输出日志
+	// 所有转发都失败时 Run 返回这些错误
+	OnForwardError func(proxy ProxyConfig, err error)
+
+	// OnTransfer 在每个转发连接关闭时上报流量，rx/tx 相对于本地接受的连接
+	OnTransfer nets.TransferFunc
+
+	// OnListen 在每个转发开始监听后调用，addr 为实际监听的地址，可以用于获取端口为 0 时分配的端口，
+	// RemoteForward 时为在服务端注册的 /host/port 路径，因此 RemoteForward 不支持端口 0
+	OnListen func(proxy ProxyConfig, addr net.Addr)
+
+	// Clock 用于 keepalive 和空闲超时的计时，为空时使用 clock.Real
+	Clock clock.Clock
 }
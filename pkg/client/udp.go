@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/clock"
+	"github.com/pigeonligh/srp/pkg/nets"
+	"github.com/pigeonligh/srp/pkg/protocol"
+	"github.com/sirupsen/logrus"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// 每个来源地址对应一个 channel，超过 DefaultUDPIdleTimeout 没有数据时关闭
+var DefaultUDPIdleTimeout = time.Minute
+
+type udpSession struct {
+	ch    gossh.Channel
+	timer clock.Timer
+}
+
+func handleUDPForward(client *gossh.Client, wait func() error, clk clock.Clock, proxy ProxyConfig, channels *channelCounter, onListen func(net.Addr)) error {
+	pc, err := listenConfig(proxy).ListenPacket(context.Background(), proxy.Network, net.JoinHostPort(proxy.LocalHost, proxy.LocalPort))
+	if err != nil {
+		return err
+	}
+	onListen(pc.LocalAddr())
+
+	waitErr := make(chan error, 1)
+	go func() {
+		err := wait()
+		_ = pc.Close()
+		waitErr <- err
+	}()
+
+	var mutex sync.Mutex
+	sessions := make(map[string]*udpSession)
+	defer func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, s := range sessions {
+			_ = s.ch.Close()
+		}
+	}()
+
+	buf := make([]byte, nets.MaxDatagramSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return <-waitErr
+			}
+			_ = pc.Close()
+			return err
+		}
+
+		mutex.Lock()
+		s, ok := sessions[addr.String()]
+		mutex.Unlock()
+		if !ok {
+			s, err = openUDPSession(client, clk, proxy, channels, addr)
+			if err != nil {
+				logrus.Errorf("Failed to open udp channel for %v: %v", addr, err)
+				continue
+			}
+			mutex.Lock()
+			sessions[addr.String()] = s
+			mutex.Unlock()
+
+			go func(addr net.Addr) {
+				defer func() {
+					mutex.Lock()
+					delete(sessions, addr.String())
+					mutex.Unlock()
+					_ = s.ch.Close()
+				}()
+
+				buf := make([]byte, nets.MaxDatagramSize)
+				for {
+					n, err := nets.ReadDatagram(s.ch, buf)
+					if err != nil {
+						return
+					}
+					s.timer.Reset(DefaultUDPIdleTimeout)
+					if _, err := pc.WriteTo(buf[:n], addr); err != nil {
+						return
+					}
+				}
+			}(addr)
+		}
+
+		s.timer.Reset(DefaultUDPIdleTimeout)
+		if err := nets.WriteDatagram(s.ch, buf[:n]); err != nil {
+			_ = s.ch.Close()
+		}
+	}
+}
+
+func openUDPSession(client *gossh.Client, clk clock.Clock, proxy ProxyConfig, channels *channelCounter, addr net.Addr) (*udpSession, error) {
+	target := net.JoinHostPort(proxy.RemoteHost, proxy.RemotePort)
+	ch, err := openUDPChannel(client, target, addr)
+	if err != nil {
+		return nil, err
+	}
+	ch = channels.channel(ch, target)
+	return &udpSession{
+		ch: ch,
+		timer: clk.AfterFunc(DefaultUDPIdleTimeout, func() {
+			_ = ch.Close()
+		}),
+	}, nil
+}
+
+// openUDPChannel 打开到 target 的 UDP channel，channel 中的数据报格式见 nets.WriteDatagram
+func openUDPChannel(client *gossh.Client, target string, origin net.Addr) (gossh.Channel, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	remotePort, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+	payload := protocol.DirectPayload{
+		Host: host,
+		Port: uint32(remotePort),
+	}
+	if udpAddr, ok := origin.(*net.UDPAddr); ok {
+		payload.OriginatorAddress = udpAddr.IP.String()
+		payload.OriginatorPort = uint32(udpAddr.Port)
+	}
+
+	ch, reqs, err := client.OpenChannel(protocol.DirectUDPChannelType, gossh.Marshal(&payload))
+	if err != nil {
+		return nil, err
+	}
+	go gossh.DiscardRequests(reqs)
+	return ch, nil
+}
@@ -0,0 +1,59 @@
+package clock
+
+import "time"
+
+// Clock 抽象了与时间相关的操作，测试中可以替换为 clocktest.Fake 以避免真实的等待
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer 为 AfterFunc 返回的计时器，*time.Timer 实现了该接口
+type Timer interface {
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// Real 使用 time 包的实现
+var Real Clock = realClock{}
+
+// Or 在 c 为空时返回 Real
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,161 @@
+package clocktest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/clock"
+)
+
+// Fake 只在调用 Advance 时前进，到期的 After 和 Ticker 会在 Advance 中触发
+type Fake struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+type waiter struct {
+	at     time.Time
+	period time.Duration // 为 0 时只触发一次
+	ch     chan time.Time
+	fn     func() // AfterFunc 的回调，与 time.AfterFunc 相同在单独的 goroutine 中执行
+}
+
+var _ clock.Clock = &Fake{}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	w := &waiter{at: f.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- f.now
+		return w.ch
+	}
+	f.waiters = append(f.waiters, w)
+	return w.ch
+}
+
+func (f *Fake) NewTicker(d time.Duration) clock.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	w := &waiter{at: f.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.waiters = append(f.waiters, w)
+	return &fakeTicker{f: f, w: w}
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) clock.Timer {
+	t := &fakeTimer{f: f, w: &waiter{fn: fn}}
+	t.Reset(d)
+	return t
+}
+
+// Advance 将时间前进 d，并按时间顺序触发期间到期的 After 和 Ticker，
+// 与 time.Ticker 相同，接收方来不及读取时多余的 tick 会被丢弃
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	end := f.now.Add(d)
+	for {
+		next := f.next(end)
+		if next == nil {
+			break
+		}
+		f.now = next.at
+		if next.fn != nil {
+			go next.fn()
+		} else {
+			select {
+			case next.ch <- f.now:
+			default:
+			}
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			f.remove(next)
+		}
+	}
+	f.now = end
+}
+
+// Waiters 返回尚未触发的 After 和未停止的 Ticker 数量，可以用于等待被测代码开始等待
+func (f *Fake) Waiters() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.waiters)
+}
+
+func (f *Fake) next(end time.Time) *waiter {
+	var ret *waiter
+	for _, w := range f.waiters {
+		if w.at.After(end) {
+			continue
+		}
+		if ret == nil || w.at.Before(ret.at) {
+			ret = w
+		}
+	}
+	return ret
+}
+
+func (f *Fake) remove(w *waiter) bool {
+	for i, v := range f.waiters {
+		if v == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct {
+	f *Fake
+	w *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.f.mutex.Lock()
+	defer t.f.mutex.Unlock()
+	t.f.remove(t.w)
+}
+
+type fakeTimer struct {
+	f *Fake
+	w *waiter
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.f.mutex.Lock()
+	defer t.f.mutex.Unlock()
+	active := t.f.remove(t.w)
+	t.w.at = t.f.now.Add(d)
+	if d <= 0 {
+		go t.w.fn()
+		return active
+	}
+	t.f.waiters = append(t.f.waiters, t.w)
+	return active
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mutex.Lock()
+	defer t.f.mutex.Unlock()
+	return t.f.remove(t.w)
+}
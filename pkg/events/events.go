@@ -0,0 +1,128 @@
+package events
+
+import (
+	"context"
+	"net"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/pigeonligh/srp/pkg/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+type AuthEvent struct {
+	User       string
+	SessionID  string
+	Method     string
+	RemoteAddr net.Addr
+	Success    bool
+}
+
+type ForwardEvent struct {
+	User        string
+	SessionID   string
+	Host        string
+	Port        string
+	BindAddress string
+	// Reason 为转发被拒绝的原因，只在 ForwardDenied 中有效
+	Reason string
+}
+
+// ConnectionEvent 描述一次代理连接，Path 为 proxy 或 reverseproxy，In/Out 相对于 SSH 客户端，只在关闭时有效
+type ConnectionEvent struct {
+	User       string
+	SessionID  string
+	Path       string
+	Target     string
+	RemoteAddr net.Addr
+	In         int64
+	Out        int64
+}
+
+// Events 在连接的各个阶段被调用，用于审计等用途
+type Events interface {
+	Authenticated(e AuthEvent)
+	ForwardRegistered(e ForwardEvent)
+	ForwardCanceled(e ForwardEvent)
+	ForwardDenied(e ForwardEvent)
+	ConnectionOpened(e ConnectionEvent)
+	ConnectionClosed(e ConnectionEvent)
+}
+
+// Nop 不处理任何事件，可以嵌入到只关心部分事件的实现中
+type Nop struct{}
+
+func (Nop) Authenticated(AuthEvent)          {}
+func (Nop) ForwardRegistered(ForwardEvent)   {}
+func (Nop) ForwardCanceled(ForwardEvent)     {}
+func (Nop) ForwardDenied(ForwardEvent)       {}
+func (Nop) ConnectionOpened(ConnectionEvent) {}
+func (Nop) ConnectionClosed(ConnectionEvent) {}
+
+var _ Events = Nop{}
+
+var DefaultQueueSize = 1024
+
+type asyncEvents struct {
+	events Events
+	queue  chan func()
+}
+
+// Async 在单独的 goroutine 中按顺序处理事件，队列满时丢弃事件，避免处理缓慢时阻塞代理
+func Async(e Events) Events {
+	if _, ok := e.(*asyncEvents); ok {
+		return e
+	}
+	a := &asyncEvents{
+		events: e,
+		queue:  make(chan func(), DefaultQueueSize),
+	}
+	go func() {
+		for f := range a.queue {
+			f()
+		}
+	}()
+	return a
+}
+
+func (a *asyncEvents) push(f func()) {
+	select {
+	case a.queue <- f:
+	default:
+		logrus.Warnf("Event queue is full, dropping event")
+	}
+}
+
+func (a *asyncEvents) Authenticated(e AuthEvent) {
+	a.push(func() { a.events.Authenticated(e) })
+}
+
+func (a *asyncEvents) ForwardRegistered(e ForwardEvent) {
+	a.push(func() { a.events.ForwardRegistered(e) })
+}
+
+func (a *asyncEvents) ForwardCanceled(e ForwardEvent) {
+	a.push(func() { a.events.ForwardCanceled(e) })
+}
+
+func (a *asyncEvents) ForwardDenied(e ForwardEvent) {
+	a.push(func() { a.events.ForwardDenied(e) })
+}
+
+func (a *asyncEvents) ConnectionOpened(e ConnectionEvent) {
+	a.push(func() { a.events.ConnectionOpened(e) })
+}
+
+func (a *asyncEvents) ConnectionClosed(e ConnectionEvent) {
+	a.push(func() { a.events.ConnectionClosed(e) })
+}
+
+func SetContextEvents(ctx ssh.Context, e Events) {
+	ctx.SetValue(protocol.ContextKeyEvents, e)
+}
+
+func FromContext(ctx context.Context) Events {
+	if e, ok := ctx.Value(protocol.ContextKeyEvents).(Events); ok {
+		return e
+	}
+	return Nop{}
+}
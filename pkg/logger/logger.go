@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Logger 是 srp 输出日志使用的接口，可以适配 slog、zap 等日志库
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// Default 返回默认的 logrus 日志
+func Default() Logger {
+	return logrus.StandardLogger()
+}
+
+// DebugEnabled 判断 l 是否会输出 Debug 日志，用于跳过热路径上参数的计算，
+// l 无法判断日志级别时返回 true
+func DebugEnabled(l Logger) bool {
+	if ll, ok := l.(interface{ IsLevelEnabled(logrus.Level) bool }); ok {
+		return ll.IsLevelEnabled(logrus.DebugLevel)
+	}
+	return true
+}
+
+type contextLogger struct{}
+
+func ContextWithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextLogger{}, l)
+}
+
+func FromContext(ctx context.Context) (Logger, bool) {
+	l, ok := ctx.Value(contextLogger{}).(Logger)
+	return l, ok
+}
+
+// WithField 为 l 输出的日志附加字段，l 不支持结构化字段时以 key=value 的形式附加在日志开头
+func WithField(l Logger, key string, value any) Logger {
+	if fl, ok := l.(logrus.FieldLogger); ok {
+		return fl.WithField(key, value)
+	}
+	return &fieldLogger{Logger: l, prefix: fmt.Sprintf("%v=%v ", key, value)}
+}
+
+type fieldLogger struct {
+	Logger
+	prefix string
+}
+
+func (l *fieldLogger) Debugf(format string, args ...any) { l.Logger.Debugf(l.prefix+format, args...) }
+func (l *fieldLogger) Infof(format string, args ...any)  { l.Logger.Infof(l.prefix+format, args...) }
+func (l *fieldLogger) Warnf(format string, args ...any)  { l.Logger.Warnf(l.prefix+format, args...) }
+func (l *fieldLogger) Errorf(format string, args ...any) { l.Logger.Errorf(l.prefix+format, args...) }
+
+// Printer 将 Logger 适配为只有 Printf 的接口
+type Printer struct {
+	Logger
+}
+
+func (p Printer) Printf(format string, args ...any) {
+	p.Infof(format, args...)
+}
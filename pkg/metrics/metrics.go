@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/pigeonligh/srp/pkg/protocol"
+)
+
+// Metrics 收集服务端的运行指标，in/out 均相对于 SSH 客户端
+type Metrics interface {
+	ConnectionOpened()
+	ConnectionClosed()
+	Authenticated(method string, success bool)
+	ForwardAdded()
+	ForwardRemoved()
+	Transferred(path string, in, out int64)
+}
+
+// ChannelMetrics 可以由 Metrics 实现，用于统计 channel open 的结果
+type ChannelMetrics interface {
+	// ChannelOpened 在 channel open 被接受或拒绝时调用，reason 为拒绝原因，如 "administratively prohibited"
+	ChannelOpened(channelType string, accepted bool, reason string)
+}
+
+type Nop struct{}
+
+func (Nop) ConnectionOpened()                  {}
+func (Nop) ConnectionClosed()                  {}
+func (Nop) Authenticated(string, bool)         {}
+func (Nop) ForwardAdded()                      {}
+func (Nop) ForwardRemoved()                    {}
+func (Nop) Transferred(string, int64, int64)   {}
+func (Nop) ChannelOpened(string, bool, string) {}
+
+var (
+	_ Metrics        = Nop{}
+	_ ChannelMetrics = Nop{}
+)
+
+func SetContextMetrics(ctx ssh.Context, m Metrics) {
+	ctx.SetValue(protocol.ContextKeyMetrics, m)
+}
+
+func FromContext(ctx context.Context) Metrics {
+	if m, ok := ctx.Value(protocol.ContextKeyMetrics).(Metrics); ok {
+		return m
+	}
+	return Nop{}
+}
@@ -0,0 +1,96 @@
+package prom
+
+import (
+	"github.com/pigeonligh/srp/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type promMetrics struct {
+	connectionsActive prometheus.Gauge
+	connectionsTotal  prometheus.Counter
+	authTotal         *prometheus.CounterVec
+	forwardsActive    prometheus.Gauge
+	bytesTotal        *prometheus.CounterVec
+	channelsTotal     *prometheus.CounterVec
+}
+
+func New(registerer prometheus.Registerer) (metrics.Metrics, error) {
+	m := &promMetrics{
+		connectionsActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "srp_connections_active",
+			Help: "Number of active SSH connections.",
+		}),
+		connectionsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "srp_connections_total",
+			Help: "Total number of accepted SSH connections.",
+		}),
+		authTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "srp_auth_attempts_total",
+			Help: "Total number of authentication attempts.",
+		}, []string{"method", "result"}),
+		forwardsActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "srp_forwards_active",
+			Help: "Number of active reverse forwards.",
+		}),
+		bytesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "srp_proxied_bytes_total",
+			Help: "Total number of proxied bytes, direction is relative to the SSH client.",
+		}, []string{"path", "direction"}),
+		channelsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "srp_channel_opens_total",
+			Help: "Total number of channel open requests by type and result.",
+		}, []string{"type", "result", "reason"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.connectionsActive,
+		m.connectionsTotal,
+		m.authTotal,
+		m.forwardsActive,
+		m.bytesTotal,
+		m.channelsTotal,
+	} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *promMetrics) ConnectionOpened() {
+	m.connectionsActive.Inc()
+	m.connectionsTotal.Inc()
+}
+
+func (m *promMetrics) ConnectionClosed() {
+	m.connectionsActive.Dec()
+}
+
+func (m *promMetrics) Authenticated(method string, success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	m.authTotal.WithLabelValues(method, result).Inc()
+}
+
+func (m *promMetrics) ForwardAdded() {
+	m.forwardsActive.Inc()
+}
+
+func (m *promMetrics) ForwardRemoved() {
+	m.forwardsActive.Dec()
+}
+
+func (m *promMetrics) Transferred(path string, in, out int64) {
+	m.bytesTotal.WithLabelValues(path, "in").Add(float64(in))
+	m.bytesTotal.WithLabelValues(path, "out").Add(float64(out))
+}
+
+func (m *promMetrics) ChannelOpened(channelType string, accepted bool, reason string) {
+	result := "rejected"
+	if accepted {
+		result = "accepted"
+	}
+	m.channelsTotal.WithLabelValues(channelType, result, reason).Inc()
+}
@@ -3,18 +3,55 @@ package nets
 import (
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/sync/errgroup"
 )
 
+// DefaultCopyBufferSize 为转发连接时每个方向使用的缓冲区大小，
+// 较大的缓冲区在高吞吐的转发中可以减少系统调用次数，但每个连接会占用更多内存（每个连接两个缓冲区）
 var DefaultCopyBufferSize = 8192
 
+// copyBufferPools 按大小缓存拷贝使用的缓冲区，避免每个连接都重新分配
+var copyBufferPools sync.Map
+
+func getCopyBuffer(size int) (*[]byte, *sync.Pool) {
+	v, ok := copyBufferPools.Load(size)
+	if !ok {
+		v, _ = copyBufferPools.LoadOrStore(size, &sync.Pool{
+			New: func() any {
+				b := make([]byte, size)
+				return &b
+			},
+		})
+	}
+	pool := v.(*sync.Pool)
+	return pool.Get().(*[]byte), pool
+}
+
 func IOCopy(dst io.Writer, src io.Reader) error {
-	_, err := io.CopyBuffer(dst, src, make([]byte, DefaultCopyBufferSize))
+	return IOCopyBuffer(dst, src, 0)
+}
+
+// IOCopyBuffer 与 IOCopy 相同，但使用 size 大小的缓冲区，size 为 0 时使用 DefaultCopyBufferSize
+// 两端都是未包装的 *net.TCPConn 时 io.CopyBuffer 会先交给 ReadFrom 处理，Linux 上使用 splice 且不使用缓冲区；
+// 经过 SSH channel 或被 CountingConn 等包装的连接总是在用户态拷贝
+func IOCopyBuffer(dst io.Writer, src io.Reader, size int) error {
+	if size <= 0 {
+		size = DefaultCopyBufferSize
+	}
+	buf, pool := getCopyBuffer(size)
+	defer pool.Put(buf)
+	_, err := io.CopyBuffer(dst, src, *buf)
 	return err
 }
 
 func HandleConnections(c1, c2 io.ReadWriteCloser) error {
+	return HandleConnectionsBuffer(c1, c2, 0)
+}
+
+// HandleConnectionsBuffer 与 HandleConnections 相同，但每个方向使用 size 大小的缓冲区，见 IOCopyBuffer
+func HandleConnectionsBuffer(c1, c2 io.ReadWriteCloser, size int) error {
 	var o sync.Once
 	cleanup := func() {
 		o.Do(func() {
@@ -25,7 +62,7 @@ func HandleConnections(c1, c2 io.ReadWriteCloser) error {
 	defer cleanup()
 
 	handleDirect := func(w io.Writer, r io.Reader) error {
-		err := IOCopy(w, r)
+		err := IOCopyBuffer(w, r, size)
 		if err != nil && err != io.EOF {
 			cleanup() // 如果一端出错，关闭连接
 		} else {
@@ -51,3 +88,37 @@ func ConnCloseWrite(c any) {
 		_ = cw.CloseWrite()
 	}
 }
+
+// TransferFunc 在连接关闭时上报流量，rx 为从连接读取的字节数，tx 为写入连接的字节数
+type TransferFunc func(id string, rx, tx int64)
+
+type CountingConn struct {
+	io.ReadWriteCloser
+	rx atomic.Int64
+	tx atomic.Int64
+}
+
+func NewCountingConn(c io.ReadWriteCloser) *CountingConn {
+	return &CountingConn{ReadWriteCloser: c}
+}
+
+func (c *CountingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	c.rx.Add(int64(n))
+	return n, err
+}
+
+func (c *CountingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	c.tx.Add(int64(n))
+	return n, err
+}
+
+func (c *CountingConn) CloseWrite() error {
+	ConnCloseWrite(c.ReadWriteCloser)
+	return nil
+}
+
+func (c *CountingConn) Transferred() (int64, int64) {
+	return c.rx.Load(), c.tx.Load()
+}
@@ -0,0 +1,84 @@
+package nets
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+// tcpPair 返回一对已连接的 TCP 连接
+func tcpPair(b *testing.B) (*net.TCPConn, *net.TCPConn) {
+	b.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	c1, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	c2 := <-accepted
+	if c2 == nil {
+		b.Fatal("accept failed")
+	}
+	b.Cleanup(func() {
+		_ = c1.Close()
+		_ = c2.Close()
+	})
+	return c1.(*net.TCPConn), c2.(*net.TCPConn)
+}
+
+// userspaceConn 隐藏 ReadFrom 和 WriteTo，模拟经过 SSH channel 或包装后的连接
+type userspaceConn struct {
+	io.ReadWriter
+}
+
+func benchmarkIOCopy(b *testing.B, wrap func(*net.TCPConn) io.ReadWriter) {
+	const chunk = 1 << 20
+	// source 写入 → srcConn 读出，拷贝到 dstConn → sink 读出
+	source, srcConn := tcpPair(b)
+	dstConn, sink := tcpPair(b)
+
+	go func() {
+		buf := make([]byte, 64<<10)
+		for written := 0; written < b.N*chunk; {
+			n, err := source.Write(buf[:min(len(buf), b.N*chunk-written)])
+			if err != nil {
+				return
+			}
+			written += n
+		}
+		_ = source.CloseWrite()
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, sink)
+		done <- err
+	}()
+
+	b.SetBytes(chunk)
+	b.ResetTimer()
+	if err := IOCopyBuffer(wrap(dstConn), wrap(srcConn), 0); err != nil {
+		b.Fatal(err)
+	}
+	_ = dstConn.CloseWrite()
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkIOCopyTCP 两端都是 *net.TCPConn，Linux 上使用 splice
+func BenchmarkIOCopyTCP(b *testing.B) {
+	benchmarkIOCopy(b, func(c *net.TCPConn) io.ReadWriter { return c })
+}
+
+// BenchmarkIOCopyUserspace 与 BenchmarkIOCopyTCP 使用相同的连接，但在用户态拷贝
+func BenchmarkIOCopyUserspace(b *testing.B) {
+	benchmarkIOCopy(b, func(c *net.TCPConn) io.ReadWriter { return userspaceConn{c} })
+}
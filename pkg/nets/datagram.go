@@ -0,0 +1,87 @@
+package nets
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// 在流式连接（如 SSH channel）中传输 UDP 数据报时，每个数据报以 2 字节大端长度作为前缀
+
+const MaxDatagramSize = 65535
+
+func WriteDatagram(w io.Writer, b []byte) error {
+	if len(b) > MaxDatagramSize {
+		return fmt.Errorf("datagram too large: %v", len(b))
+	}
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+	_, err := w.Write(frame)
+	return err
+}
+
+func ReadDatagram(r io.Reader, buf []byte) (int, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	size := int(binary.BigEndian.Uint16(header[:]))
+	if size > len(buf) {
+		return 0, fmt.Errorf("datagram too large: %v", size)
+	}
+	return io.ReadFull(r, buf[:size])
+}
+
+// HandleDatagrams 在帧格式的流和数据报连接之间转发数据，任意一端结束时关闭两端
+func HandleDatagrams(stream io.ReadWriteCloser, packet net.Conn) error {
+	var o sync.Once
+	cleanup := func() {
+		o.Do(func() {
+			_ = stream.Close()
+			_ = packet.Close()
+		})
+	}
+	defer cleanup()
+
+	var pipes errgroup.Group
+	pipes.Go(func() error {
+		defer cleanup()
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, err := ReadDatagram(stream, buf)
+			if err != nil {
+				return ignoreClosed(err)
+			}
+			if _, err := packet.Write(buf[:n]); err != nil {
+				return ignoreClosed(err)
+			}
+		}
+	})
+	pipes.Go(func() error {
+		defer cleanup()
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, err := packet.Read(buf)
+			if err != nil {
+				return ignoreClosed(err)
+			}
+			if err := WriteDatagram(stream, buf[:n]); err != nil {
+				return ignoreClosed(err)
+			}
+		}
+	})
+	return pipes.Wait()
+}
+
+func ignoreClosed(err error) error {
+	if err == io.EOF || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package nets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	DefaultHappyEyeballsStagger        = 250 * time.Millisecond
+	DefaultHappyEyeballsResolveTimeout = 5 * time.Second
+)
+
+// HappyEyeballsDialer 按 RFC 8305 解析目标后交替使用 IPv6 与 IPv4 地址，
+// 每隔 Stagger 发起一次新的尝试，返回第一个成功的连接并关闭其余的连接
+type HappyEyeballsDialer struct {
+	// 为空时使用 net.DefaultResolver
+	Resolver *net.Resolver
+	// 连接单个地址使用的 dialer，为空时使用 DefaultNetDialer
+	Dialer         NetDialer
+	Stagger        time.Duration
+	ResolveTimeout time.Duration
+}
+
+var _ NetDialer = (*HappyEyeballsDialer)(nil)
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+func (d *HappyEyeballsDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = DefaultNetDialer
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := d.resolve(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	stagger := d.Stagger
+	if stagger <= 0 {
+		stagger = DefaultHappyEyeballsStagger
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	next, pending := 0, 0
+	start := func() {
+		target := net.JoinHostPort(ips[next].String(), port)
+		next++
+		pending++
+		go func() {
+			conn, err := dialer.DialContext(ctx, network, target)
+			select {
+			case results <- dialResult{conn, err}:
+			case <-ctx.Done():
+				// 已经有其他地址连接成功
+				if conn != nil {
+					_ = conn.Close()
+				}
+			}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(stagger)
+	defer timer.Stop()
+
+	var errs []error
+	for pending > 0 {
+		var timeout <-chan time.Time
+		if next < len(ips) {
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case <-timeout:
+			start()
+			timer.Reset(stagger)
+
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.conn, nil
+			}
+			errs = append(errs, r.err)
+			// 失败时立即尝试下一个地址
+			if next < len(ips) {
+				start()
+				timer.Reset(stagger)
+			}
+		}
+	}
+	return nil, fmt.Errorf("dial %v: %w", addr, errors.Join(errs...))
+}
+
+func (d *HappyEyeballsDialer) resolve(ctx context.Context, network, host string) ([]net.IP, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	timeout := d.ResolveTimeout
+	if timeout <= 0 {
+		timeout = DefaultHappyEyeballsResolveTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var v4, v6 []net.IP
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			v4 = append(v4, a.IP)
+		} else {
+			v6 = append(v6, a.IP)
+		}
+	}
+	switch network {
+	case "tcp4", "udp4":
+		v6 = nil
+	case "tcp6", "udp6":
+		v4 = nil
+	}
+
+	// 交替排列两个地址族，优先 IPv6
+	ips := make([]net.IP, 0, len(v4)+len(v6))
+	for i := 0; i < max(len(v4), len(v6)); i++ {
+		if i < len(v6) {
+			ips = append(ips, v6[i])
+		}
+		if i < len(v4) {
+			ips = append(ips, v4[i])
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found for %v", host)
+	}
+	return ips, nil
+}
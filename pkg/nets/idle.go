@@ -0,0 +1,73 @@
+package nets
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/clock"
+)
+
+// IdleConn 记录连接的读写活动，超过 timeout 没有任何读写时调用 onIdle
+// 两个方向的拷贝共享同一个计时器，任一方向有数据都会重置
+type IdleConn struct {
+	io.ReadWriteCloser
+	clock     clock.Clock
+	timeout   time.Duration
+	timer     clock.Timer
+	lastRead  atomic.Int64
+	lastWrite atomic.Int64
+}
+
+// NewIdleConn 创建 IdleConn，onIdle 的参数为读、写两端各自的空闲时长
+func NewIdleConn(c io.ReadWriteCloser, timeout time.Duration, onIdle func(readIdle, writeIdle time.Duration)) *IdleConn {
+	return NewIdleConnWithClock(c, clock.Real, timeout, onIdle)
+}
+
+// NewIdleConnWithClock 与 NewIdleConn 相同，使用 clk 计时，测试中可以使用 clocktest.Fake
+func NewIdleConnWithClock(c io.ReadWriteCloser, clk clock.Clock, timeout time.Duration, onIdle func(readIdle, writeIdle time.Duration)) *IdleConn {
+	ic := &IdleConn{
+		ReadWriteCloser: c,
+		clock:           clock.Or(clk),
+		timeout:         timeout,
+	}
+	now := ic.clock.Now().UnixNano()
+	ic.lastRead.Store(now)
+	ic.lastWrite.Store(now)
+	ic.timer = ic.clock.AfterFunc(timeout, func() {
+		now := ic.clock.Now()
+		onIdle(
+			now.Sub(time.Unix(0, ic.lastRead.Load())),
+			now.Sub(time.Unix(0, ic.lastWrite.Load())),
+		)
+	})
+	return ic
+}
+
+func (c *IdleConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		c.lastRead.Store(c.clock.Now().UnixNano())
+		c.timer.Reset(c.timeout)
+	}
+	return n, err
+}
+
+func (c *IdleConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	if n > 0 {
+		c.lastWrite.Store(c.clock.Now().UnixNano())
+		c.timer.Reset(c.timeout)
+	}
+	return n, err
+}
+
+func (c *IdleConn) CloseWrite() error {
+	ConnCloseWrite(c.ReadWriteCloser)
+	return nil
+}
+
+// Stop 停止空闲检测
+func (c *IdleConn) Stop() {
+	c.timer.Stop()
+}
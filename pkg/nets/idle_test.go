@@ -0,0 +1,47 @@
+package nets
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/clock/clocktest"
+)
+
+func TestIdleConnWithFakeClock(t *testing.T) {
+	clk := clocktest.NewFake(time.Unix(0, 0))
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	type idle struct{ read, write time.Duration }
+	idled := make(chan idle, 1)
+	ic := NewIdleConnWithClock(c1, clk, time.Minute, func(read, write time.Duration) {
+		idled <- idle{read, write}
+	})
+	defer ic.Stop()
+
+	clk.Advance(40 * time.Second)
+	go func() { _, _ = c2.Write([]byte("x")) }()
+	if _, err := ic.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 读取重置了计时器，原来的超时时间点不再触发
+	clk.Advance(40 * time.Second)
+	select {
+	case <-idled:
+		t.Fatal("onIdle called before the connection is idle")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clk.Advance(20 * time.Second)
+	select {
+	case got := <-idled:
+		if got.read != time.Minute || got.write != 100*time.Second {
+			t.Fatalf("idle = %+v, want read 1m0s and write 1m40s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("onIdle is not called after the idle timeout")
+	}
+}
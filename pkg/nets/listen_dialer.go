@@ -5,34 +5,82 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"syscall"
+	"time"
 )
 
-type listenDialer chan net.Conn
+// accept 遇到临时错误时重试的间隔，与 http.Server 相同，从 5ms 开始翻倍，最长 1s
+const (
+	minAcceptRetryDelay = 5 * time.Millisecond
+	maxAcceptRetryDelay = time.Second
+)
+
+type listenDialer struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newListenDialer(size int) *listenDialer {
+	return &listenDialer{
+		conns:  make(chan net.Conn, size),
+		closed: make(chan struct{}),
+	}
+}
+
+func (ld *listenDialer) Accept() (net.Conn, error) {
+	select {
+	case <-ld.closed:
+		return nil, net.ErrClosed
+	default:
+	}
 
-func (ld listenDialer) Accept() (net.Conn, error) {
-	c, ok := <-ld
-	if ok {
+	select {
+	case c := <-ld.conns:
 		return c, nil
+
+	case <-ld.closed:
+		return nil, net.ErrClosed
 	}
-	return nil, net.ErrClosed
 }
 
-func (ld listenDialer) Close() error {
-	close(ld)
+func (ld *listenDialer) Close() error {
+	ld.once.Do(func() {
+		close(ld.closed)
+		// 关闭尚未被 Accept 的连接，避免 Dial 端一直等待
+		for {
+			select {
+			case c := <-ld.conns:
+				_ = c.Close()
+			default:
+				return
+			}
+		}
+	})
 	return nil
 }
 
-func (ld listenDialer) Addr() net.Addr {
+func (ld *listenDialer) Addr() net.Addr {
 	return &net.UnixAddr{
 		Net:  "channel",
 		Name: "listendialer",
 	}
 }
 
-func (ld listenDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+func (ld *listenDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	select {
+	case <-ld.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+
 	c1, c2 := net.Pipe()
+	if origin, ok := ctx.Value(contextOriginAddr{}).(net.Addr); ok {
+		c1 = &originConn{Conn: c1, origin: origin}
+	}
 	select {
-	case ld <- c1:
+	case ld.conns <- c1:
 		return c2, nil
 
 	case <-ctx.Done():
@@ -45,28 +93,140 @@ func (ld listenDialer) DialContext(ctx context.Context, network, addr string) (n
 	}
 }
 
+type contextOriginAddr struct{}
+
+// ContextWithOriginAddr 设置通过 ListenDialer 建立的连接在 Accept 一侧的 RemoteAddr，
+// 如发起连接的 SSH 客户端的地址，未设置时为 net.Pipe 的地址
+func ContextWithOriginAddr(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, contextOriginAddr{}, addr)
+}
+
+type originConn struct {
+	net.Conn
+	origin net.Addr
+}
+
+func (c *originConn) RemoteAddr() net.Addr {
+	return c.origin
+}
+
 func ListenDialer() (net.Listener, NetDialer) {
-	ld := make(listenDialer)
+	ld := newListenDialer(0)
 	return ld, ld
 }
 
 func ListenDialerWithBuffer(size int) (net.Listener, NetDialer) {
-	ld := make(listenDialer, size)
+	ld := newListenDialer(size)
 	return ld, ld
 }
 
 func HandleListener(l net.Listener, h func(net.Conn)) error {
+	return HandleListenerContext(context.Background(), l, h)
+}
+
+type listenerOptions struct {
+	tracker   *sync.WaitGroup
+	limit     int
+	onTempErr func(err error, delay time.Duration)
+}
+
+type ListenerOption func(*listenerOptions)
+
+// WithTracker 记录每个连接的处理，调用方可以通过 tracker.Wait() 等待所有处理结束
+func WithTracker(tracker *sync.WaitGroup) ListenerOption {
+	return func(o *listenerOptions) {
+		o.tracker = tracker
+	}
+}
+
+// WithAcceptRetryHandler 在 Accept 遇到临时错误（如 EMFILE）并准备在 delay 后重试时调用，一般用于输出日志
+func WithAcceptRetryHandler(f func(err error, delay time.Duration)) ListenerOption {
+	return func(o *listenerOptions) {
+		o.onTempErr = f
+	}
+}
+
+// WithConcurrencyLimit 限制同时处理的连接数，达到上限时暂停 Accept 直到有连接处理结束
+func WithConcurrencyLimit(limit int) ListenerOption {
+	return func(o *listenerOptions) {
+		o.limit = limit
+	}
+}
+
+// HandleListenerContext 在 ctx 结束时关闭 l 并返回，主动关闭 l 时返回 nil
+// 使用 WithConcurrencyLimit 时，关闭 l 的同时需要结束 ctx，才能让等待中的 Accept 立即返回
+func HandleListenerContext(ctx context.Context, l net.Listener, h func(net.Conn), opts ...ListenerOption) error {
+	var o listenerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var sem chan struct{}
+	if o.limit > 0 {
+		sem = make(chan struct{}, o.limit)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = l.Close()
+	})
+	defer stop()
+
+	var delay time.Duration
 	for {
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
 		c, err := l.Accept()
 		if err != nil {
-			if errors.Is(err, net.ErrClosed) {
+			if sem != nil {
+				<-sem
+			}
+			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
 				return nil
 			}
-			return fmt.Errorf("listener accept: %w", err)
+			if !isTemporaryAcceptError(err) {
+				return fmt.Errorf("listener accept: %w", err)
+			}
+
+			delay = min(max(delay*2, minAcceptRetryDelay), maxAcceptRetryDelay)
+			if o.onTempErr != nil {
+				o.onTempErr(err, delay)
+			}
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil
+			}
+			continue
+		}
+		delay = 0
+		if o.tracker != nil {
+			o.tracker.Add(1)
 		}
 		go func() {
+			if o.tracker != nil {
+				defer o.tracker.Done()
+			}
+			if sem != nil {
+				defer func() { <-sem }()
+			}
 			h(c)
 			_ = c.Close()
 		}()
 	}
 }
+
+// isTemporaryAcceptError 判断 Accept 的错误是否可以重试，如文件描述符耗尽、连接在 accept 前被对端重置等
+func isTemporaryAcceptError(err error) bool {
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) || errors.Is(err, syscall.ECONNABORTED) {
+		return true
+	}
+	var ne interface{ Temporary() bool }
+	return errors.As(err, &ne) && ne.Temporary()
+}
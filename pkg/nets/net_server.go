@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/pigeonligh/srp/pkg/logger"
 	"github.com/sirupsen/logrus"
 )
 
@@ -45,18 +46,16 @@ type NetServer interface {
 
 func RunNetServer(ctx context.Context, s NetServer, l net.Listener) error {
 	name, _ := GetServerNameFromContext(ctx)
-	logger := logrus.WithField("netserver", name)
-
-	var serverErr error
-	done := make(chan struct{}, 1)
+	var log logger.Logger = logrus.WithField("netserver", name)
+	if l, ok := logger.FromContext(ctx); ok {
+		log = l
+	}
 
-	go func() {
-		<-ctx.Done()
-		done <- struct{}{}
-	}()
+	// Serve 在 Shutdown 后才返回，结果通过 channel 传递，不能在 Shutdown 后直接读取
+	serveErr := make(chan error, 1)
 
 	go func() {
-		logger.Info("Server start")
+		log.Infof("Server start")
 
 		var err error
 		if l == nil {
@@ -65,22 +64,27 @@ func RunNetServer(ctx context.Context, s NetServer, l net.Listener) error {
 			err = s.Serve(l)
 		}
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Infof("Server run error: %v", err)
-			serverErr = err
+			log.Infof("Server run error: %v", err)
+		} else {
+			err = nil
 		}
-		done <- struct{}{}
+		serveErr <- err
 	}()
 
-	<-done
-	logger.Info("Server stopping")
+	var serverErr error
+	select {
+	case <-ctx.Done():
+	case serverErr = <-serveErr:
+	}
+	log.Infof("Server stopping")
 
 	stopCtx, cancel := context.WithTimeout(context.Background(), GetStopTimeoutFromContext(ctx))
 	defer cancel()
 
 	if err := s.Shutdown(stopCtx); err != nil {
-		logger.Infof("Server stop error: %v", err)
+		log.Infof("Server stop error: %v", err)
 		return err
 	}
-	logger.Info("Server stopped")
+	log.Infof("Server stopped")
 	return serverErr
 }
@@ -0,0 +1,90 @@
+package nets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type RetryPolicy struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// 最多尝试的次数（包含第一次），为 0 时不限制
+	MaxAttempts int
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	MaxAttempts:    5,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	return p
+}
+
+// RetrySSHDialer 在遇到可重试的网络错误时按退避策略重新拨号，认证失败等错误直接返回
+func RetrySSHDialer(inner SSHDialer, policy RetryPolicy) SSHDialer {
+	policy = policy.withDefaults()
+	return SSHDialerFunc(func(ctx context.Context, network, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
+		backoff := policy.InitialBackoff
+		for attempt := 1; ; attempt++ {
+			client, err := inner.DialContext(ctx, network, addr, config)
+			if err == nil {
+				return client, nil
+			}
+			if ctx.Err() != nil || !IsRetryableError(err) {
+				return nil, err
+			}
+			if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+				return nil, fmt.Errorf("give up after %v attempts: %w", attempt, err)
+			}
+
+			logrus.Warnf("Dial %v failed: %v, retrying in %v", addr, err, backoff)
+			select {
+			case <-ctx.Done():
+				return nil, err
+
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, policy.MaxBackoff)
+		}
+	})
+}
+
+// IsRetryableError 判断错误是否为临时的网络错误，如 DNS 解析失败、连接被拒绝、超时等
+func IsRetryableError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout || dnsErr.IsNotFound
+	}
+	for _, errno := range []syscall.Errno{
+		syscall.ECONNREFUSED,
+		syscall.ECONNRESET,
+		syscall.ECONNABORTED,
+		syscall.EHOSTUNREACH,
+		syscall.ENETUNREACH,
+		syscall.ETIMEDOUT,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,77 @@
+package nets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// failingDialer 前 failures 次拨号返回 err，之后成功
+type failingDialer struct {
+	failures int
+	err      error
+	attempts int
+}
+
+func (d *failingDialer) DialContext(ctx context.Context, network, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
+	d.attempts++
+	if d.attempts <= d.failures {
+		return nil, d.err
+	}
+	return nil, nil
+}
+
+func TestRetrySSHDialer(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxAttempts: 5}
+	refused := fmt.Errorf("dial: %w", syscall.ECONNREFUSED)
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		wantErr  bool
+		attempts int
+	}{
+		{"first attempt", 0, refused, false, 1},
+		{"retry until success", 3, refused, false, 4},
+		{"give up", 10, refused, true, 5},
+		{"not retryable", 10, errors.New("ssh: unable to authenticate"), true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &failingDialer{failures: tt.failures, err: tt.err}
+			_, err := RetrySSHDialer(d, policy).DialContext(context.Background(), "tcp", "example.com:22", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want wrapping %v", err, tt.err)
+			}
+			if d.attempts != tt.attempts {
+				t.Fatalf("attempts = %v, want %v", d.attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetrySSHDialerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &failingDialer{failures: 10, err: syscall.ECONNREFUSED}
+	policy := RetryPolicy{InitialBackoff: time.Hour, MaxAttempts: 5}
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := RetrySSHDialer(d, policy).DialContext(ctx, "tcp", "example.com:22", nil); err == nil {
+		t.Fatal("dial should fail after cancel")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("dial returned after %v", elapsed)
+	}
+	if d.attempts != 1 {
+		t.Fatalf("attempts = %v, want 1", d.attempts)
+	}
+}
@@ -0,0 +1,217 @@
+package nets
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	socks5Version = 0x05
+
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+
+	socks5CmdConnect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+)
+
+var socks5Replies = map[byte]string{
+	0x01: "general failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// Auth 是 SOCKS5 的用户名密码认证信息
+type Auth struct {
+	User     string
+	Password string
+}
+
+// SOCKS5Dialer 通过 proxyAddr 上的 SOCKS5 代理连接目标，auth 为空时使用无认证方式
+// forward 用于连接代理本身，为空时使用 DefaultNetDialer
+func SOCKS5Dialer(proxyAddr string, auth *Auth, forward NetDialer) NetDialer {
+	if forward == nil {
+		forward = DefaultNetDialer
+	}
+	return NetDialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+		default:
+			return nil, fmt.Errorf("socks5: network %v is not supported", network)
+		}
+
+		conn, err := forward.DialContext(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("connect to socks5 proxy %v: %w", proxyAddr, err)
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		stop := context.AfterFunc(ctx, func() {
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		})
+		defer stop()
+
+		if err := socks5Handshake(conn, auth, addr); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("socks5 proxy %v: %w", proxyAddr, err)
+		}
+		if !stop() {
+			_ = conn.Close()
+			return nil, ctx.Err()
+		}
+		_ = conn.SetDeadline(time.Time{})
+		return conn, nil
+	})
+}
+
+func socks5Handshake(conn net.Conn, auth *Auth, addr string) error {
+	methods := []byte{socks5AuthNone}
+	if auth != nil {
+		methods = []byte{socks5AuthNone, socks5AuthPassword}
+	}
+	if _, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != socks5Version {
+		return fmt.Errorf("unexpected version %v", buf[0])
+	}
+	switch buf[1] {
+	case socks5AuthNone:
+
+	case socks5AuthPassword:
+		if auth == nil {
+			return errors.New("password authentication required")
+		}
+		if len(auth.User) > 255 || len(auth.Password) > 255 {
+			return errors.New("user or password too long")
+		}
+		req := []byte{0x01, byte(len(auth.User))}
+		req = append(req, auth.User...)
+		req = append(req, byte(len(auth.Password)))
+		req = append(req, auth.Password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		if buf[1] != 0x00 {
+			return errors.New("authentication failed")
+		}
+
+	default:
+		return errors.New("no acceptable authentication methods")
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	req, err := AppendSOCKS5Addr(req, addr)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0x00 {
+		if msg, ok := socks5Replies[header[1]]; ok {
+			return fmt.Errorf("connect to %v: %v", addr, msg)
+		}
+		return fmt.Errorf("connect to %v: unknown reply %v", addr, header[1])
+	}
+	// 丢弃代理返回的绑定地址
+	_, err = ReadSOCKS5Addr(conn)
+	return err
+}
+
+// AppendSOCKS5Addr 将 host:port 编码为 SOCKS5 地址格式
+func AppendSOCKS5Addr(b []byte, addr string) ([]byte, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b = append(b, socks5AddrIPv4)
+			b = append(b, ip4...)
+		} else {
+			b = append(b, socks5AddrIPv6)
+			b = append(b, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host %q too long", host)
+		}
+		b = append(b, socks5AddrDomain, byte(len(host)))
+		b = append(b, host...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(p)), nil
+}
+
+// ReadSOCKS5Addr 读取 SOCKS5 地址格式并返回 host:port
+func ReadSOCKS5Addr(r io.Reader) (string, error) {
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+
+	var host string
+	switch buf[0] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if buf[0] == socks5AddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+
+	case socks5AddrDomain:
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		domain := make([]byte, buf[0])
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+
+	default:
+		return "", fmt.Errorf("unknown address type %v", buf[0])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
@@ -0,0 +1,304 @@
+package nets
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultSOCKS5HandshakeTimeout 为 SOCKS5Server 未设置 HandshakeTimeout 时完成握手的最长时间
+var DefaultSOCKS5HandshakeTimeout = 10 * time.Second
+
+type SOCKS5Command byte
+
+const (
+	SOCKS5Connect      SOCKS5Command = socks5CmdConnect
+	SOCKS5Bind         SOCKS5Command = 0x02
+	SOCKS5UDPAssociate SOCKS5Command = 0x03
+)
+
+const (
+	socks5AuthNoAcceptable = 0xff
+
+	socks5PasswordVersion = 0x01
+	socks5PasswordSuccess = 0x00
+	socks5PasswordFailure = 0x01
+
+	socks5ReplySucceeded           = 0x00
+	socks5ReplyGeneralFailure      = 0x01
+	socks5ReplyCommandNotSupported = 0x07
+	socks5ReplyAddrNotSupported    = 0x08
+)
+
+// SOCKS5Server 处理 SOCKS5 客户端的握手，Dial 和 DialUDP 为空时对应的命令会被拒绝，BIND 总是被拒绝
+//
+// UDP ASSOCIATE 时，每个目标地址通过 DialUDP 得到一个数据报流，
+// 流中每个数据报使用 WriteDatagram 的格式（2 字节大端长度 + 数据），不包含 SOCKS5 的 UDP 头
+//
+// 握手中每个变长字段的长度都只有 1 字节，因此单次握手最多读取约 1KB 的数据
+type SOCKS5Server struct {
+	Dial    func(ctx context.Context, addr string) (net.Conn, error)
+	DialUDP func(ctx context.Context, addr string) (io.ReadWriteCloser, error)
+
+	// Auth 不为空时要求客户端使用用户名密码认证（RFC 1929）
+	Auth *Auth
+
+	// HandshakeTimeout 限制从连接建立到读取完请求的时间，避免慢速的客户端一直占用连接，
+	// 为 0 时使用 DefaultSOCKS5HandshakeTimeout，为负数时不限制
+	HandshakeTimeout time.Duration
+}
+
+// Negotiate 完成 c 上的握手，CONNECT 时返回已连接的目标，由调用方在两者之间转发；
+// UDP ASSOCIATE 时一直转发数据报直到 c 关闭，返回的连接为 nil
+func (s *SOCKS5Server) Negotiate(ctx context.Context, c net.Conn) (net.Conn, error) {
+	timeout := s.HandshakeTimeout
+	if timeout == 0 {
+		timeout = DefaultSOCKS5HandshakeTimeout
+	}
+	if timeout > 0 {
+		_ = c.SetReadDeadline(time.Now().Add(timeout))
+	}
+
+	if err := s.negotiateAuth(c); err != nil {
+		return nil, handshakeError(err, timeout)
+	}
+
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return nil, handshakeError(err, timeout)
+	}
+	if header[0] != socks5Version {
+		return nil, fmt.Errorf("unexpected socks version %v", header[0])
+	}
+	addr, err := ReadSOCKS5Addr(c)
+	if err != nil {
+		_ = writeSOCKS5Reply(c, socks5ReplyAddrNotSupported, nil)
+		return nil, handshakeError(err, timeout)
+	}
+	// 请求已经读取完毕，之后的读取属于转发的数据
+	_ = c.SetReadDeadline(time.Time{})
+
+	switch cmd := SOCKS5Command(header[1]); {
+	case cmd == SOCKS5Connect && s.Dial != nil:
+		conn, err := s.Dial(ctx, addr)
+		if err != nil {
+			_ = writeSOCKS5Reply(c, socks5ReplyGeneralFailure, nil)
+			return nil, fmt.Errorf("connect to %v: %w", addr, err)
+		}
+		if err := writeSOCKS5Reply(c, socks5ReplySucceeded, nil); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return conn, nil
+
+	case cmd == SOCKS5UDPAssociate && s.DialUDP != nil:
+		return nil, s.associate(ctx, c)
+
+	default:
+		_ = writeSOCKS5Reply(c, socks5ReplyCommandNotSupported, nil)
+		return nil, fmt.Errorf("socks command %v is not supported", cmd)
+	}
+}
+
+func (s *SOCKS5Server) negotiateAuth(c net.Conn) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return err
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("unexpected socks version %v", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return err
+	}
+	method := byte(socks5AuthNone)
+	if s.Auth != nil {
+		method = socks5AuthPassword
+	}
+	if !bytes.Contains(methods, []byte{method}) {
+		_, _ = c.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+		return fmt.Errorf("no acceptable socks auth method in %v", methods)
+	}
+	if _, err := c.Write([]byte{socks5Version, method}); err != nil {
+		return err
+	}
+	if s.Auth == nil {
+		return nil
+	}
+	return s.authenticate(c)
+}
+
+// authenticate 读取 VER ULEN UNAME PLEN PASSWD 并校验，失败时回复失败状态并返回错误
+func (s *SOCKS5Server) authenticate(c net.Conn) error {
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return err
+	}
+	if buf[0] != socks5PasswordVersion {
+		_, _ = c.Write([]byte{socks5PasswordVersion, socks5PasswordFailure})
+		return fmt.Errorf("unexpected socks auth version %v", buf[0])
+	}
+	user := make([]byte, buf[1])
+	if _, err := io.ReadFull(c, user); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(c, buf[:1]); err != nil {
+		return err
+	}
+	password := make([]byte, buf[0])
+	if _, err := io.ReadFull(c, password); err != nil {
+		return err
+	}
+
+	userOK := subtle.ConstantTimeCompare(user, []byte(s.Auth.User))
+	passwordOK := subtle.ConstantTimeCompare(password, []byte(s.Auth.Password))
+	if userOK&passwordOK != 1 {
+		_, _ = c.Write([]byte{socks5PasswordVersion, socks5PasswordFailure})
+		return fmt.Errorf("socks authentication failed for user %q", user)
+	}
+	_, err := c.Write([]byte{socks5PasswordVersion, socks5PasswordSuccess})
+	return err
+}
+
+func handshakeError(err error, timeout time.Duration) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("socks handshake is not finished in %v", timeout)
+	}
+	return err
+}
+
+func writeSOCKS5Reply(c net.Conn, reply byte, bind net.Addr) error {
+	addr := "0.0.0.0:0"
+	if bind != nil {
+		addr = bind.String()
+	}
+	b, err := AppendSOCKS5Addr([]byte{socks5Version, reply, 0x00}, addr)
+	if err != nil {
+		return err
+	}
+	_, err = c.Write(b)
+	return err
+}
+
+// associate 在控制连接的本地地址上分配 UDP 中继，只接受来自控制连接对端 IP 的数据报
+func (s *SOCKS5Server) associate(ctx context.Context, c net.Conn) error {
+	localIP := "0.0.0.0"
+	if addr, ok := c.LocalAddr().(*net.TCPAddr); ok {
+		localIP = addr.IP.String()
+	}
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(localIP, "0"))
+	if err != nil {
+		_ = writeSOCKS5Reply(c, socks5ReplyGeneralFailure, nil)
+		return err
+	}
+	defer pc.Close()
+	if err := writeSOCKS5Reply(c, socks5ReplySucceeded, pc.LocalAddr()); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// 控制连接关闭时结束 association
+	go func() {
+		_, _ = io.Copy(io.Discard, c)
+		cancel()
+		_ = pc.Close()
+	}()
+
+	var clientIP net.IP
+	if addr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+		clientIP = addr.IP
+	}
+
+	var mutex sync.Mutex
+	var clientAddr net.Addr
+	streams := make(map[string]io.ReadWriteCloser)
+	var wg sync.WaitGroup
+	defer func() {
+		mutex.Lock()
+		for _, stream := range streams {
+			_ = stream.Close()
+		}
+		mutex.Unlock()
+		wg.Wait()
+	}()
+
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if udpAddr, ok := from.(*net.UDPAddr); ok && clientIP != nil && !clientIP.IsUnspecified() && !udpAddr.IP.Equal(clientIP) {
+			continue
+		}
+
+		// RSV(2) FRAG(1) ADDR DATA，不支持分片
+		if n < 4 || buf[2] != 0 {
+			continue
+		}
+		r := bytes.NewReader(buf[3:n])
+		target, err := ReadSOCKS5Addr(r)
+		if err != nil {
+			continue
+		}
+		data := buf[n-r.Len() : n]
+
+		mutex.Lock()
+		clientAddr = from
+		stream, ok := streams[target]
+		mutex.Unlock()
+		if !ok {
+			stream, err = s.DialUDP(ctx, target)
+			if err != nil {
+				continue
+			}
+			mutex.Lock()
+			streams[target] = stream
+			mutex.Unlock()
+
+			wg.Add(1)
+			go func(target string, stream io.ReadWriteCloser) {
+				defer wg.Done()
+				defer func() {
+					mutex.Lock()
+					delete(streams, target)
+					mutex.Unlock()
+					_ = stream.Close()
+				}()
+
+				header, err := AppendSOCKS5Addr([]byte{0x00, 0x00, 0x00}, target)
+				if err != nil {
+					return
+				}
+				buf := make([]byte, MaxDatagramSize)
+				for {
+					n, err := ReadDatagram(stream, buf)
+					if err != nil {
+						return
+					}
+					mutex.Lock()
+					to := clientAddr
+					mutex.Unlock()
+					if _, err := pc.WriteTo(append(header, buf[:n]...), to); err != nil {
+						return
+					}
+				}
+			}(target, stream)
+		}
+		if err := WriteDatagram(stream, data); err != nil {
+			_ = stream.Close()
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package nets
+
+import (
+	"fmt"
+	"slices"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// gossh 支持的算法，包括默认未启用的算法
+var (
+	supportedSSHCiphers = []string{
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+		"arcfour256", "arcfour128", "arcfour",
+		"aes128-cbc", "3des-cbc",
+	}
+	supportedSSHMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-sha1-96",
+	}
+	supportedSSHKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	}
+	// gossh 只实现了 group exchange 的客户端
+	clientOnlySSHKeyExchanges = []string{
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	}
+)
+
+// SSHAlgorithms 限制 SSH 连接协商使用的算法，按优先级排列，为空的字段使用 gossh 的默认值
+type SSHAlgorithms struct {
+	Ciphers      []string
+	MACs         []string
+	KeyExchanges []string
+}
+
+// Validate 检查所有算法都被 gossh 支持
+func (a SSHAlgorithms) Validate() error {
+	if err := checkSSHAlgorithms("cipher", a.Ciphers, supportedSSHCiphers); err != nil {
+		return err
+	}
+	if err := checkSSHAlgorithms("MAC", a.MACs, supportedSSHMACs); err != nil {
+		return err
+	}
+	return checkSSHAlgorithms("key exchange", a.KeyExchanges, supportedSSHKeyExchanges)
+}
+
+// ValidateServer 与 Validate 相同，但同时拒绝只能用于客户端的算法
+func (a SSHAlgorithms) ValidateServer() error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	for _, kex := range a.KeyExchanges {
+		if slices.Contains(clientOnlySSHKeyExchanges, kex) {
+			return fmt.Errorf("key exchange %q is not supported by the server", kex)
+		}
+	}
+	return nil
+}
+
+// Apply 将设置的算法写入 config
+func (a SSHAlgorithms) Apply(config *gossh.Config) {
+	if len(a.Ciphers) > 0 {
+		config.Ciphers = slices.Clone(a.Ciphers)
+	}
+	if len(a.MACs) > 0 {
+		config.MACs = slices.Clone(a.MACs)
+	}
+	if len(a.KeyExchanges) > 0 {
+		config.KeyExchanges = slices.Clone(a.KeyExchanges)
+	}
+}
+
+func checkSSHAlgorithms(kind string, algorithms, supported []string) error {
+	for _, algo := range algorithms {
+		if !slices.Contains(supported, algo) {
+			return fmt.Errorf("unknown %v %q, supported: %v", kind, algo, supported)
+		}
+	}
+	return nil
+}
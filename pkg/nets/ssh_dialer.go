@@ -2,6 +2,8 @@ package nets
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	gossh "golang.org/x/crypto/ssh"
 )
@@ -16,19 +18,91 @@ func (f SSHDialerFunc) DialContext(ctx context.Context, network, addr string, co
 	return f(ctx, network, addr, config)
 }
 
+func sshDial(ctx context.Context, netDialer NetDialer, network, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	conn, err := netDialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %v%v: %w", addr, stalled(ctx), err)
+	}
+
+	// NewClientConn 不支持 context，通过连接的 deadline 限制握手时间
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	sshConn, chans, reqs, err := gossh.NewClientConn(conn, addr, config)
+	stop()
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %v%v: %w", addr, stalled(ctx), err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return gossh.NewClient(sshConn, chans, reqs), nil
+}
+
+func stalled(ctx context.Context) string {
+	if ctx.Err() != nil {
+		return " stalled"
+	}
+	return ""
+}
+
 func NetSSHDialer(netDialer NetDialer) SSHDialer {
 	if netDialer == nil {
 		netDialer = DefaultNetDialer
 	}
 	return SSHDialerFunc(func(ctx context.Context, network, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
-		conn, err := netDialer.DialContext(ctx, network, addr)
-		if err != nil {
-			return nil, err
+		return sshDial(ctx, netDialer, network, addr, config)
+	})
+}
+
+type SSHHop struct {
+	Network string
+	Address string
+	Config  *gossh.ClientConfig
+}
+
+// JumpSSHDialer 依次经过 hops 中的跳板机连接目标，效果同 ssh -J
+func JumpSSHDialer(netDialer NetDialer, hops ...SSHHop) SSHDialer {
+	if netDialer == nil {
+		netDialer = DefaultNetDialer
+	}
+	return SSHDialerFunc(func(ctx context.Context, network, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
+		clients := make([]*gossh.Client, 0, len(hops)+1)
+		closeAll := func() {
+			for i := len(clients) - 1; i >= 0; i-- {
+				_ = clients[i].Close()
+			}
 		}
-		sshConn, chans, reqs, err := gossh.NewClientConn(conn, addr, config)
-		if err != nil {
-			return nil, err
+
+		d := netDialer
+		route := append(append(make([]SSHHop, 0, len(hops)+1), hops...), SSHHop{
+			Network: network,
+			Address: addr,
+			Config:  config,
+		})
+		for _, hop := range route {
+			client, err := sshDial(ctx, d, hop.Network, hop.Address, hop.Config)
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("jump to %v: %w", hop.Address, err)
+			}
+			clients = append(clients, client)
+			d = client
 		}
-		return gossh.NewClient(sshConn, chans, reqs), nil
+
+		target := clients[len(clients)-1]
+		go func() {
+			_ = target.Wait()
+			closeAll()
+		}()
+		return target, nil
 	})
 }
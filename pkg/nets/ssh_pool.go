@@ -0,0 +1,145 @@
+package nets
+
+import (
+	"context"
+	"sync"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// SSHClientReleaser 由复用连接的 SSHDialer 实现，通过它获得的 client 需要调用 Release 释放，而不是直接 Close
+type SSHClientReleaser interface {
+	Release(client *gossh.Client) error
+}
+
+// SSHPoolIdentity 返回认证信息的标识，只有标识相同的 config 才会共享连接，
+// HostKeyCallback 或 AuthMethods 不同时必须返回不同的值
+type SSHPoolIdentity func(config *gossh.ClientConfig) string
+
+type pooledClient struct {
+	key    string
+	client *gossh.Client
+	refs   int
+	broken bool
+
+	// 拨号完成后关闭，err 为拨号的结果
+	ready chan struct{}
+	err   error
+}
+
+// SSHClientPool 按 network、address、user 和 SSHPoolIdentity 复用 SSH 连接，
+// 通过引用计数在最后一个使用者释放时关闭，连接断开后下一次 DialContext 重新拨号
+type SSHClientPool struct {
+	inner    SSHDialer
+	identity SSHPoolIdentity
+
+	mutex   sync.Mutex
+	clients map[string]*pooledClient
+	owners  map[*gossh.Client]*pooledClient
+}
+
+var (
+	_ SSHDialer         = (*SSHClientPool)(nil)
+	_ SSHClientReleaser = (*SSHClientPool)(nil)
+)
+
+// PoolingSSHDialer 返回复用连接的 SSHDialer，inner 为空时使用 NetSSHDialer，identity 不能为空
+func PoolingSSHDialer(inner SSHDialer, identity SSHPoolIdentity) *SSHClientPool {
+	if identity == nil {
+		panic("nil identity for PoolingSSHDialer")
+	}
+	if inner == nil {
+		inner = NetSSHDialer(nil)
+	}
+	return &SSHClientPool{
+		inner:    inner,
+		identity: identity,
+		clients:  make(map[string]*pooledClient),
+		owners:   make(map[*gossh.Client]*pooledClient),
+	}
+}
+
+func (p *SSHClientPool) DialContext(ctx context.Context, network, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
+	key := network + "|" + addr + "|" + config.User + "|" + p.identity(config)
+	for {
+		p.mutex.Lock()
+		pc, ok := p.clients[key]
+		if !ok {
+			pc = &pooledClient{key: key, ready: make(chan struct{})}
+			p.clients[key] = pc
+			p.mutex.Unlock()
+			return p.dial(ctx, pc, network, addr, config)
+		}
+		p.mutex.Unlock()
+
+		// 等待同一个 key 上正在进行的拨号
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case <-pc.ready:
+		}
+
+		p.mutex.Lock()
+		if pc.err == nil && !pc.broken {
+			pc.refs++
+			p.mutex.Unlock()
+			return pc.client, nil
+		}
+		p.mutex.Unlock()
+		// 拨号失败或连接已断开，重新拨号
+	}
+}
+
+func (p *SSHClientPool) dial(ctx context.Context, pc *pooledClient, network, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
+	client, err := p.inner.DialContext(ctx, network, addr, config)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	defer close(pc.ready)
+
+	if err != nil {
+		pc.err = err
+		p.remove(pc)
+		return nil, err
+	}
+	pc.client = client
+	pc.refs = 1
+	p.owners[client] = pc
+
+	go func() {
+		_ = client.Wait()
+
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		pc.broken = true
+		p.remove(pc)
+	}()
+	return client, nil
+}
+
+// Release 释放通过 DialContext 获得的 client，最后一个使用者释放时关闭连接，
+// 传输出错时（如 keepalive 失败）使用者可以直接 Close，之后的 DialContext 会重新拨号
+func (p *SSHClientPool) Release(client *gossh.Client) error {
+	p.mutex.Lock()
+	pc, ok := p.owners[client]
+	if !ok {
+		p.mutex.Unlock()
+		return client.Close()
+	}
+	pc.refs--
+	if pc.refs > 0 {
+		p.mutex.Unlock()
+		return nil
+	}
+	delete(p.owners, client)
+	p.remove(pc)
+	p.mutex.Unlock()
+	return client.Close()
+}
+
+func (p *SSHClientPool) remove(pc *pooledClient) {
+	if p.clients[pc.key] == pc {
+		delete(p.clients, pc.key)
+	}
+}
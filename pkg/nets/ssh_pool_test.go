@@ -0,0 +1,193 @@
+package nets
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type testSSHServer struct {
+	addr       string
+	handshakes atomic.Int64
+
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+// newTestSSHServer 启动一个不需要认证、只回复全局请求的 SSH 服务端
+func newTestSSHServer(t *testing.T) *testSSHServer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &gossh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSSHServer{addr: l.Addr().String()}
+	t.Cleanup(func() {
+		_ = l.Close()
+		s.closeConns()
+	})
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.conns = append(s.conns, c)
+			s.mutex.Unlock()
+			go func() {
+				_, chans, reqs, err := gossh.NewServerConn(c, config)
+				if err != nil {
+					return
+				}
+				s.handshakes.Add(1)
+				go func() {
+					for req := range reqs {
+						_ = req.Reply(true, nil)
+					}
+				}()
+				for ch := range chans {
+					_ = ch.Reject(gossh.Prohibited, "")
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) closeConns() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.conns = nil
+}
+
+func testClientConfig(user string) *gossh.ClientConfig {
+	return &gossh.ClientConfig{User: user, HostKeyCallback: gossh.InsecureIgnoreHostKey(), Timeout: 5 * time.Second}
+}
+
+func alive(client *gossh.Client) bool {
+	_, _, err := client.SendRequest("ping", true, nil)
+	return err == nil
+}
+
+func TestSSHClientPoolShareAndRelease(t *testing.T) {
+	s := newTestSSHServer(t)
+	pool := PoolingSSHDialer(nil, func(*gossh.ClientConfig) string { return "key" })
+	ctx := context.Background()
+
+	c1, err := pool.DialContext(ctx, "tcp", s.addr, testClientConfig("u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := pool.DialContext(ctx, "tcp", s.addr, testClientConfig("u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 != c2 || s.handshakes.Load() != 1 {
+		t.Fatalf("client is not shared, %v handshakes", s.handshakes.Load())
+	}
+
+	if err := pool.Release(c1); err != nil {
+		t.Fatal(err)
+	}
+	if !alive(c2) {
+		t.Fatal("client is closed while still in use")
+	}
+	_ = pool.Release(c2)
+	if alive(c2) {
+		t.Fatal("client is not closed after the last release")
+	}
+
+	c3, err := pool.DialContext(ctx, "tcp", s.addr, testClientConfig("u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release(c3)
+	if c3 == c1 || s.handshakes.Load() != 2 {
+		t.Fatal("released client is reused")
+	}
+}
+
+func TestSSHClientPoolKey(t *testing.T) {
+	s := newTestSSHServer(t)
+	pool := PoolingSSHDialer(nil, func(config *gossh.ClientConfig) string { return config.ClientVersion })
+	ctx := context.Background()
+
+	base, err := pool.DialContext(ctx, "tcp", s.addr, testClientConfig("u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release(base)
+
+	other := testClientConfig("u")
+	other.ClientVersion = "SSH-2.0-other"
+	for _, config := range []*gossh.ClientConfig{testClientConfig("v"), other} {
+		client, err := pool.DialContext(ctx, "tcp", s.addr, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pool.Release(client)
+		if client == base {
+			t.Fatalf("client is shared between user %v and identity %q", config.User, config.ClientVersion)
+		}
+	}
+	if n := s.handshakes.Load(); n != 3 {
+		t.Fatalf("handshakes = %v, want 3", n)
+	}
+}
+
+func TestSSHClientPoolRedialAfterTransportError(t *testing.T) {
+	s := newTestSSHServer(t)
+	pool := PoolingSSHDialer(nil, func(*gossh.ClientConfig) string { return "key" })
+	ctx := context.Background()
+
+	c1, err := pool.DialContext(ctx, "tcp", s.addr, testClientConfig("u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release(c1)
+	s.closeConns()
+	_ = c1.Wait()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		c2, err := pool.DialContext(ctx, "tcp", s.addr, testClientConfig("u"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c2 != c1 {
+			defer pool.Release(c2)
+			if !alive(c2) {
+				t.Fatal("new client is not usable")
+			}
+			return
+		}
+		// Wait 返回后 pool 在另一个 goroutine 中移除断开的连接
+		_ = pool.Release(c2)
+		if time.Now().After(deadline) {
+			t.Fatal("broken client is still returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,53 @@
+package nets
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// DefaultTLSSSHProtocol 为 tls.Config 未设置 NextProtos 时使用的 ALPN，前置的代理可以据此将连接路由到 SSH 服务
+var DefaultTLSSSHProtocol = "ssh"
+
+// TLSSSHDialer 先与服务端建立 TLS 连接，再在其上进行 SSH 握手，
+// tlsConfig 未设置 ServerName 时使用 addr 中的主机名
+func TLSSSHDialer(tlsConfig *tls.Config) SSHDialer {
+	d := NetDialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialTLS(ctx, DefaultNetDialer, tlsConfig, network, addr)
+	})
+	return SSHDialerFunc(func(ctx context.Context, network, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
+		return sshDial(ctx, d, network, addr, config)
+	})
+}
+
+func dialTLS(ctx context.Context, netDialer NetDialer, tlsConfig *tls.Config, network, addr string) (net.Conn, error) {
+	var config *tls.Config
+	if tlsConfig != nil {
+		config = tlsConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config.ServerName = host
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{DefaultTLSSSHProtocol}
+	}
+
+	conn, err := netDialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
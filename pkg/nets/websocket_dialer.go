@@ -0,0 +1,55 @@
+package nets
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketSSHDialer 通过 WebSocket（ws:// 或 wss://）连接 wsURL，并在其上建立 SSH 连接，
+// 用于只能通过 HTTPS 或 CDN 出网的环境，header 中可以携带认证 token 等，
+// DialContext 的 network 和 addr 只用于 host key 校验
+func WebSocketSSHDialer(wsURL string, header http.Header) SSHDialer {
+	d := NetDialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialWebSocket(ctx, wsURL, header)
+	})
+	return SSHDialerFunc(func(ctx context.Context, network, addr string, config *gossh.ClientConfig) (*gossh.Client, error) {
+		return sshDial(ctx, d, network, addr, config)
+	})
+}
+
+func dialWebSocket(ctx context.Context, wsURL string, header http.Header) (net.Conn, error) {
+	location, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, err
+	}
+	origin := *location
+	switch location.Scheme {
+	case "ws":
+		origin.Scheme = "http"
+	case "wss":
+		origin.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q", location.Scheme)
+	}
+
+	config, err := websocket.NewConfig(location.String(), origin.String())
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		config.Header[k] = v
+	}
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// SSH 的数据是二进制的，默认的文本帧会被部分代理按 UTF-8 校验
+	ws.PayloadType = websocket.BinaryFrame
+	return ws, nil
+}
@@ -6,7 +6,19 @@ type contextKey struct {
 
 var ContextKeyReverseProxyAuthed = &contextKey{"rp_authed"}
 var ContextKeyProxyAuthed = &contextKey{"p_authed"}
+var ContextKeyMetrics = &contextKey{"metrics"}
+var ContextKeyEvents = &contextKey{"events"}
+var ContextKeyAuthorizedKeyOptions = &contextKey{"authorized_key_options"}
+var ContextKeyGroups = &contextKey{"groups"}
+var ContextKeyJWTClaims = &contextKey{"jwt_claims"}
+var ContextKeyIdentity = &contextKey{"identity"}
+
+// 传给 ProxyProvide 和 TargetResolver 的 context 中的连接信息，通过 proxy.UserFromContext 等读取
+var ContextKeyUser = &contextKey{"user"}
+var ContextKeySessionID = &contextKey{"session_id"}
+var ContextKeyRemoteAddr = &contextKey{"remote_addr"}
 
 type CachedProxyKey struct {
-	Target string
+	Network string
+	Target  string
 }
@@ -7,16 +7,46 @@ const (
 	CancelRequestType  = "cancel-streamlocal-forward@openssh.com"
 
 	ForwardedRequestType = "forwarded-streamlocal@openssh.com"
+
+	// OpenSSH 客户端 ssh -R 使用的标准请求，见 RFC 4254 7.1
+	TCPIPForwardRequestType       = "tcpip-forward"
+	CancelTCPIPForwardRequestType = "cancel-tcpip-forward"
+	ForwardedTCPIPChannelType     = "forwarded-tcpip"
+
+	// ssh -L 和 ssh -D 使用的标准 channel，payload 为 DirectPayload
+	DirectTCPIPChannelType = "direct-tcpip"
+
+	KeepAliveRequestType = "keepalive@openssh.com"
+
+	// SRP 扩展：通过 channel 转发 UDP，payload 同 DirectPayload，数据报格式见 nets.WriteDatagram
+	DirectUDPChannelType = "direct-udp@srp"
 )
 
 type RemoteForwardRequest struct {
 	BindUnixSocket string // It's target in srp
 }
 
+type RemoteForwardSuccess struct {
+	BindPort uint32
+}
+
 type RemoteForwardCancelRequest struct {
 	BindUnixSocket string // It's target in srp
 }
 
+// TCPIPForwardRequest 为 tcpip-forward 和 cancel-tcpip-forward 请求的 payload
+type TCPIPForwardRequest struct {
+	BindAddr string
+	BindPort uint32
+}
+
+type ForwardedTCPIPChannelData struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
 type RemoteForwardChannelData struct {
 	SocketPath string
 	Reserved   string
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"context"
+	"net"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/pigeonligh/srp/pkg/protocol"
+)
+
+// ContextWithConnMetadata 将发起代理的 SSH 连接信息写入 ctx
+func ContextWithConnMetadata(ctx context.Context, user, sessionID string, remoteAddr net.Addr) context.Context {
+	ctx = context.WithValue(ctx, protocol.ContextKeyUser, user)
+	ctx = context.WithValue(ctx, protocol.ContextKeySessionID, sessionID)
+	return context.WithValue(ctx, protocol.ContextKeyRemoteAddr, remoteAddr)
+}
+
+// UserFromContext 返回发起代理的 SSH 用户，ctx 为 ssh.Context 时也可以读取
+func UserFromContext(ctx context.Context) (string, bool) {
+	if user, ok := ctx.Value(protocol.ContextKeyUser).(string); ok {
+		return user, true
+	}
+	user, ok := ctx.Value(ssh.ContextKeyUser).(string)
+	return user, ok
+}
+
+func SessionIDFromContext(ctx context.Context) (string, bool) {
+	if id, ok := ctx.Value(protocol.ContextKeySessionID).(string); ok {
+		return id, true
+	}
+	id, ok := ctx.Value(ssh.ContextKeySessionID).(string)
+	return id, ok
+}
+
+func RemoteAddrFromContext(ctx context.Context) (net.Addr, bool) {
+	if addr, ok := ctx.Value(protocol.ContextKeyRemoteAddr).(net.Addr); ok {
+		return addr, true
+	}
+	addr, ok := ctx.Value(ssh.ContextKeyRemoteAddr).(net.Addr)
+	return addr, ok
+}
@@ -6,9 +6,11 @@ import (
 
 	"github.com/charmbracelet/ssh"
 	"github.com/pigeonligh/srp/pkg/auth"
+	"github.com/pigeonligh/srp/pkg/events"
+	"github.com/pigeonligh/srp/pkg/logger"
+	"github.com/pigeonligh/srp/pkg/metrics"
 	"github.com/pigeonligh/srp/pkg/nets"
 	"github.com/pigeonligh/srp/pkg/protocol"
-	"github.com/sirupsen/logrus"
 	gossh "golang.org/x/crypto/ssh"
 )
 
@@ -17,18 +19,25 @@ type Handler interface {
 	PublicKeyHandler() ssh.PublicKeyHandler
 
 	HandleProxy(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context)
+	HandleUDPProxy(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context)
 }
 
 type handler struct {
+	logger        logger.Logger
 	authenticator auth.Authenticator
 	authorizer    auth.Authorizer
 	provider      ProxyProvider
+	udpProvider   ProxyProvider
+	resolver      TargetResolver
 	cacheEnabled  bool
 	callbacks     ProxyCallbacks
+
+	copyBufferSize int
 }
 
 func New(authenticator auth.Authenticator, authorizer auth.Authorizer, provider ProxyProvider, cacheEnabled bool) Handler {
 	return &handler{
+		logger:        logger.Default(),
 		authenticator: authenticator,
 		authorizer:    authorizer,
 		provider:      provider,
@@ -37,7 +46,9 @@ func New(authenticator auth.Authenticator, authorizer auth.Authorizer, provider
 }
 
 func NewWithOptions(options ...Option) Handler {
-	h := &handler{}
+	h := &handler{
+		logger: logger.Default(),
+	}
 	for _, opt := range options {
 		opt(h)
 	}
@@ -83,6 +94,10 @@ func (h *handler) PublicKeyHandler() ssh.PublicKeyHandler {
 }
 
 func (h *handler) GetProxy(ctx ssh.Context, target string) (Proxy, error) {
+	return h.getProxy(ctx, h.provider, "tcp", target)
+}
+
+func (h *handler) getProxy(ctx ssh.Context, provider ProxyProvider, network, target string) (Proxy, error) {
 	authed, _ := ctx.Value(protocol.ContextKeyProxyAuthed).(bool)
 	if !authed {
 		return nil, fmt.Errorf("unauthenticated for proxy")
@@ -90,7 +105,7 @@ func (h *handler) GetProxy(ctx ssh.Context, target string) (Proxy, error) {
 
 	var cachedResult any
 	if h.cacheEnabled {
-		cacheKey := protocol.CachedProxyKey{Target: target}
+		cacheKey := protocol.CachedProxyKey{Network: network, Target: target}
 		cachedResult = ctx.Value(cacheKey)
 		if cachedResult != nil {
 			if proxy, ok := cachedResult.(Proxy); ok {
@@ -113,6 +128,7 @@ func (h *handler) GetProxy(ctx ssh.Context, target string) (Proxy, error) {
 			Target:     target,
 			RemoteAddr: ctx.RemoteAddr(),
 			LocalAddr:  ctx.LocalAddr(),
+			Identity:   auth.IdentityFromContext(ctx),
 		}) {
 			err := fmt.Errorf("access denied")
 			cachedResult = err
@@ -120,11 +136,25 @@ func (h *handler) GetProxy(ctx ssh.Context, target string) (Proxy, error) {
 		}
 	}
 
-	if h.provider == nil {
-		return nil, fmt.Errorf("proxy provider is not set")
+	if provider == nil {
+		return nil, fmt.Errorf("%v proxy provider is not set", network)
+	}
+
+	pctx := ContextWithConnMetadata(ctx, ctx.User(), ctx.SessionID(), ctx.RemoteAddr())
+	if h.resolver != nil {
+		resolved, err := h.resolver.Resolve(pctx, target)
+		if err != nil {
+			err = fmt.Errorf("resolve %v: %w", target, err)
+			cachedResult = err
+			return nil, err
+		}
+		if resolved != target {
+			h.logger.Debugf("Target %v is resolved to %v for %v", target, resolved, ctx.SessionID())
+		}
+		target = resolved
 	}
 
-	proxy, err := h.provider.ProxyProvide(ctx, target)
+	proxy, err := provider.ProxyProvide(pctx, target)
 	if err != nil {
 		cachedResult = err
 		return nil, err
@@ -134,27 +164,31 @@ func (h *handler) GetProxy(ctx ssh.Context, target string) (Proxy, error) {
 }
 
 func (h *handler) HandleProxy(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
-	logrus.Infof("Handle direct-tcpip for user %v in %v", ctx.User(), ctx.SessionID())
+	h.logger.Infof("Handle direct-tcpip for user %v in %v", ctx.User(), ctx.SessionID())
 	h.callbacks.OnHandleProxy(ctx)
 	defer h.callbacks.OnHandleProxyDone(ctx)
 
 	var payload protocol.DirectPayload
 	err := gossh.Unmarshal(newChan.ExtraData(), &payload)
 	if err != nil {
-		logrus.Errorf("Cannot accept extra data for %v: %v", ctx.SessionID(), err)
+		h.logger.Errorf("Cannot accept extra data for %v: %v", ctx.SessionID(), err)
+		// 不拒绝的话客户端会一直等待 channel 打开的结果
+		if rejectErr := newChan.Reject(gossh.ConnectionFailed, "invalid direct-tcpip payload"); rejectErr != nil {
+			h.logger.Errorf("Cannot reject channel for %v: %v", ctx.SessionID(), rejectErr)
+		}
 		return
 	}
-	logrus.Infof("Payload for session %v: %v", ctx.SessionID(), payload)
+	h.logger.Infof("Payload for session %v: %v", ctx.SessionID(), payload)
 
 	proxy, err := h.GetProxy(ctx, net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port)))
 	if err != nil {
 		rejectErr := newChan.Reject(gossh.Prohibited, fmt.Sprintf("Cannot get proxy for session %v: %v", ctx.SessionID(), err))
 		if rejectErr != nil {
-			logrus.Errorf("Cannot reject channel for %v: %v", ctx.SessionID(), rejectErr)
+			h.logger.Errorf("Cannot reject channel for %v: %v", ctx.SessionID(), rejectErr)
 		}
 
 		h.callbacks.OnProxyCreateFailed(ctx, payload, err)
-		logrus.Errorf("Cannot create proxy for %v: %v", ctx.SessionID(), err)
+		h.logger.Errorf("Cannot create proxy for %v: %v", ctx.SessionID(), err)
 		return
 	}
 	h.callbacks.OnProxyCreated(ctx, payload)
@@ -162,27 +196,41 @@ func (h *handler) HandleProxy(srv *ssh.Server, conn *gossh.ServerConn, newChan g
 	ch, _, err := newChan.Accept()
 	if err != nil {
 		h.callbacks.OnProxyChannelAcceptFailed(ctx, payload, err)
-		logrus.Errorf("Cannot accept channel for %v: %v", ctx.SessionID(), err)
+		h.logger.Errorf("Cannot accept channel for %v: %v", ctx.SessionID(), err)
 		return
 	}
 	defer ch.Close()
 	h.callbacks.OnProxyChannelAccepted(ctx, payload)
 
-	logrus.Infof("Proxy created for session %v.", ctx.SessionID())
-	c, err := proxy.Dial(ctx)
+	h.logger.Infof("Proxy created for session %v.", ctx.SessionID())
+	// 目标为内存模式的反向转发时，转发给客户端的 forwarded-tcpip channel 以此作为来源地址
+	c, err := proxy.Dial(nets.ContextWithOriginAddr(ctx, ctx.RemoteAddr()))
 	if err != nil {
 		h.callbacks.OnProxyDialFailed(ctx, payload, err)
-		logrus.Errorf("Cannot dial proxy for %v: %v", ctx.SessionID(), err)
+		h.logger.Errorf("Cannot dial proxy for %v: %v", ctx.SessionID(), err)
 		return
 	}
 	h.callbacks.OnProxyDialed(ctx, payload)
-	err = nets.HandleConnections(c, ch)
+	event := events.ConnectionEvent{
+		User:       ctx.User(),
+		SessionID:  ctx.SessionID(),
+		Path:       "proxy",
+		Target:     net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port)),
+		RemoteAddr: ctx.RemoteAddr(),
+	}
+	events.FromContext(ctx).ConnectionOpened(event)
+	cc := nets.NewCountingConn(ch)
+	err = nets.HandleConnectionsBuffer(c, cc, h.copyBufferSize)
+	in, out := cc.Transferred()
+	metrics.FromContext(ctx).Transferred("proxy", in, out)
+	event.In, event.Out = in, out
+	events.FromContext(ctx).ConnectionClosed(event)
 	if err != nil {
 		h.callbacks.OnProxyConnectionDone(ctx, payload, err)
-		logrus.Errorf("Cannot handle proxy for %v: %v", ctx.SessionID(), err)
+		h.logger.Errorf("Cannot handle proxy for %v: %v", ctx.SessionID(), err)
 		return
 	}
 
 	h.callbacks.OnProxyConnectionDone(ctx, payload, nil)
-	logrus.Infof("Proxy done for session %v.", ctx.SessionID())
+	h.logger.Infof("Proxy done for session %v.", ctx.SessionID())
 }
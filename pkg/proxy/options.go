@@ -1,9 +1,18 @@
 package proxy
 
-import "github.com/pigeonligh/srp/pkg/auth"
+import (
+	"github.com/pigeonligh/srp/pkg/auth"
+	"github.com/pigeonligh/srp/pkg/logger"
+)
 
 type Option func(*handler)
 
+func WithLogger(l logger.Logger) Option {
+	return func(h *handler) {
+		h.logger = l
+	}
+}
+
 func WithAuthenticator(authenticator auth.Authenticator) Option {
 	return func(h *handler) {
 		h.authenticator = authenticator
@@ -22,6 +31,26 @@ func WithProxyProvider(provider ProxyProvider) Option {
 	}
 }
 
+func WithUDPProxyProvider(provider ProxyProvider) Option {
+	return func(h *handler) {
+		h.udpProvider = provider
+	}
+}
+
+// WithTargetResolver 设置目标地址的改写，授权使用客户端请求的原始目标
+func WithTargetResolver(resolver TargetResolver) Option {
+	return func(h *handler) {
+		h.resolver = resolver
+	}
+}
+
+// WithCopyBufferSize 设置转发连接时每个方向的缓冲区大小，为 0 时使用 nets.DefaultCopyBufferSize
+func WithCopyBufferSize(size int) Option {
+	return func(h *handler) {
+		h.copyBufferSize = size
+	}
+}
+
 func WithCacheEnabled(enabled bool) Option {
 	return func(h *handler) {
 		h.cacheEnabled = enabled
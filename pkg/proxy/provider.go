@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
@@ -36,3 +37,76 @@ func ProxyProviderWithReadiness(p ProxyProvider, readiness func(context.Context,
 		}, interval), nil
 	})
 }
+
+func ProxyProviderWithRetry(p ProxyProvider, readiness func(context.Context, string) bool, retries int, interval time.Duration) ProxyProvider {
+	return ProxyProviderFunc(func(ctx context.Context, target string) (Proxy, error) {
+		proxy, err := p.ProxyProvide(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		return ProxyWithRetry(proxy, func(ctx context.Context) bool {
+			return readiness(ctx, target)
+		}, retries, interval), nil
+	})
+}
+
+// ProviderMiddleware 包装 ProxyProvider，用于组合超时、TLS、PROXY protocol 等行为
+type ProviderMiddleware func(ProxyProvider) ProxyProvider
+
+// Chain 依次用 middlewares 包装 base，第一个 middleware 位于最外层
+func Chain(base ProxyProvider, middlewares ...ProviderMiddleware) ProxyProvider {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		base = middlewares[i](base)
+	}
+	return base
+}
+
+func TimeoutMiddleware(timeout time.Duration) ProviderMiddleware {
+	return func(p ProxyProvider) ProxyProvider {
+		return ProxyProviderWithTimeout(p, timeout)
+	}
+}
+
+func ReadinessMiddleware(readiness func(context.Context, string) bool, interval time.Duration) ProviderMiddleware {
+	return func(p ProxyProvider) ProxyProvider {
+		return ProxyProviderWithReadiness(p, readiness, interval)
+	}
+}
+
+func RetryMiddleware(readiness func(context.Context, string) bool, retries int, interval time.Duration) ProviderMiddleware {
+	return func(p ProxyProvider) ProxyProvider {
+		return ProxyProviderWithRetry(p, readiness, retries, interval)
+	}
+}
+
+// ReadinessChecker 可以由 ProxyProvider 实现，用于判断目标是否已经可以连接
+type ReadinessChecker interface {
+	Ready(ctx context.Context, target string) bool
+}
+
+// DefaultWaitReadyInterval 为 WaitReady 的 interval 不大于 0 时的检查间隔
+var DefaultWaitReadyInterval = 100 * time.Millisecond
+
+// WaitReady 每隔 interval 检查一次 target 是否就绪，直到就绪或 ctx 结束
+// provider 必须实现 ReadinessChecker，不会为了检查而连接目标
+func WaitReady(ctx context.Context, provider ProxyProvider, target string, interval time.Duration) error {
+	c, ok := provider.(ReadinessChecker)
+	if !ok {
+		return fmt.Errorf("provider %T does not implement ReadinessChecker", provider)
+	}
+	if interval <= 0 {
+		interval = DefaultWaitReadyInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for !c.Ready(ctx, target) {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for %v ready: %w", target, ctx.Err())
+
+		case <-t.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type readinessProvider struct {
+	ProxyProviderFunc
+	checks  atomic.Int32
+	readyAt int32
+}
+
+func (p *readinessProvider) Ready(ctx context.Context, target string) bool {
+	return p.checks.Add(1) >= p.readyAt
+}
+
+func TestWaitReady(t *testing.T) {
+	p := &readinessProvider{readyAt: 3}
+	// interval 为 0 时使用默认间隔
+	if err := WaitReady(context.Background(), p, "example.com:80", 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.checks.Load(); n != 3 {
+		t.Fatalf("checks = %v, want 3", n)
+	}
+
+	p = &readinessProvider{readyAt: 1 << 30}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := WaitReady(ctx, p, "example.com:80", time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitReadyWithoutChecker(t *testing.T) {
+	dialed := false
+	p := ProxyProviderFunc(func(ctx context.Context, target string) (Proxy, error) {
+		dialed = true
+		return nil, errors.New("not reachable")
+	})
+	if err := WaitReady(context.Background(), p, "example.com:80", time.Millisecond); err == nil {
+		t.Fatal("WaitReady should fail without ReadinessChecker")
+	}
+	if dialed {
+		t.Fatal("WaitReady should not connect to the target")
+	}
+}
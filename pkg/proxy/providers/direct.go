@@ -6,6 +6,7 @@ import (
 	"github.com/pigeonligh/srp/pkg/proxy"
 )
 
+// DirectProvider 直接连接目标，Dial 时使用传入的 context，SSH 连接断开时正在进行的 DNS 解析和连接会被取消
 type DirectProvider string
 
 func (p DirectProvider) ProxyProvide(ctx context.Context, target string) (proxy.Proxy, error) {
@@ -0,0 +1,113 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/nets"
+	"github.com/pigeonligh/srp/pkg/proxy"
+	"github.com/sirupsen/logrus"
+)
+
+var DefaultHealthCheckTimeout = 3 * time.Second
+
+// DefaultHealthCheckInterval 为 FailoverProvider 的 interval 不大于 0 时的检查间隔
+var DefaultHealthCheckInterval = 10 * time.Second
+
+// TCPHealthCheck 能建立 TCP 连接即认为后端健康
+func TCPHealthCheck(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, DefaultHealthCheckTimeout)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+type failoverProvider struct {
+	primaries   []string
+	backups     []string
+	healthCheck func(addr string) bool
+	dialer      nets.NetDialer
+
+	mutex   sync.RWMutex
+	healthy map[string]bool
+}
+
+// FailoverProvider 定期检查所有后端，按顺序选择第一个健康的主后端，主后端全部不可用时才使用备用后端
+// healthCheck 为空时使用 TCPHealthCheck，检查在 ctx 结束后停止
+func FailoverProvider(ctx context.Context, primaries, backups []string, healthCheck func(addr string) bool, interval time.Duration) proxy.ProxyProvider {
+	if healthCheck == nil {
+		healthCheck = TCPHealthCheck
+	}
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	p := &failoverProvider{
+		primaries:   primaries,
+		backups:     backups,
+		healthCheck: healthCheck,
+		dialer:      nets.DefaultNetDialer,
+		healthy:     make(map[string]bool),
+	}
+	// 第一次检查完成前认为所有后端都是健康的
+	for _, addr := range p.all() {
+		p.healthy[addr] = true
+	}
+	go p.run(ctx, interval)
+	return p
+}
+
+func (p *failoverProvider) all() []string {
+	return append(append([]string{}, p.primaries...), p.backups...)
+}
+
+func (p *failoverProvider) run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		p.check()
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-t.C:
+		}
+	}
+}
+
+func (p *failoverProvider) check() {
+	var wg sync.WaitGroup
+	for _, addr := range p.all() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			healthy := p.healthCheck(addr)
+
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			if p.healthy[addr] != healthy {
+				logrus.Infof("Backend %v healthy: %v", addr, healthy)
+			}
+			p.healthy[addr] = healthy
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *failoverProvider) ProxyProvide(ctx context.Context, target string) (proxy.Proxy, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, group := range [][]string{p.primaries, p.backups} {
+		for _, addr := range group {
+			if p.healthy[addr] {
+				return &backendProxy{address: addr, dialer: p.dialer}, nil
+			}
+		}
+	}
+	return nil, errors.New("no healthy backends")
+}
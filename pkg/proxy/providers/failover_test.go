@@ -0,0 +1,32 @@
+package providers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFailoverProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var checks atomic.Int32
+	healthCheck := func(addr string) bool {
+		checks.Add(1)
+		return addr != "primary:80"
+	}
+	// interval 为 0 时使用默认间隔
+	p := FailoverProvider(ctx, []string{"primary:80"}, []string{"backup:80"}, healthCheck, 0)
+
+	deadline := time.Now().Add(time.Second)
+	for checks.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	px, err := p.ProxyProvide(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := px.(*backendProxy).address; addr != "backup:80" {
+		t.Fatalf("provided %v, want backup:80", addr)
+	}
+}
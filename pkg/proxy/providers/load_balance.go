@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/nets"
+	"github.com/pigeonligh/srp/pkg/proxy"
+	"github.com/sirupsen/logrus"
+)
+
+type LoadBalanceStrategy int
+
+const (
+	RoundRobin LoadBalanceStrategy = iota
+	Random
+)
+
+// 后端连接失败后暂时跳过的时间
+var DefaultBackendCooldown = 10 * time.Second
+
+type loadBalanceProvider struct {
+	backends []string
+	strategy LoadBalanceStrategy
+	dialer   nets.NetDialer
+
+	mutex       sync.Mutex
+	next        int
+	failedUntil map[string]time.Time
+}
+
+// LoadBalanceProvider 忽略请求的目标，按策略在 backends 中选择一个后端连接
+// 最近连接失败的后端会被跳过一段时间，所有后端都失败时仍然按策略选择
+func LoadBalanceProvider(backends []string, strategy LoadBalanceStrategy) proxy.ProxyProvider {
+	return &loadBalanceProvider{
+		backends:    backends,
+		strategy:    strategy,
+		dialer:      nets.DefaultNetDialer,
+		failedUntil: make(map[string]time.Time),
+	}
+}
+
+func (p *loadBalanceProvider) ProxyProvide(ctx context.Context, target string) (proxy.Proxy, error) {
+	backend, err := p.pick()
+	if err != nil {
+		return nil, err
+	}
+	return &backendProxy{
+		address: backend,
+		dialer:  p.dialer,
+		onError: p.markFailed,
+	}, nil
+}
+
+func (p *loadBalanceProvider) pick() (string, error) {
+	if len(p.backends) == 0 {
+		return "", errors.New("no backends")
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	start := p.next
+	if p.strategy == Random {
+		start = rand.IntN(len(p.backends))
+	}
+	now := time.Now()
+	for i := range p.backends {
+		idx := (start + i) % len(p.backends)
+		backend := p.backends[idx]
+		if p.failedUntil[backend].After(now) {
+			continue
+		}
+		p.next = idx + 1
+		return backend, nil
+	}
+	p.next = start + 1
+	return p.backends[start%len(p.backends)], nil
+}
+
+func (p *loadBalanceProvider) markFailed(backend string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	logrus.Warnf("Backend %v failed: %v, skip it for %v", backend, err, DefaultBackendCooldown)
+	p.failedUntil[backend] = time.Now().Add(DefaultBackendCooldown)
+}
+
+type backendProxy struct {
+	address string
+	dialer  nets.NetDialer
+	onError func(backend string, err error)
+}
+
+func (p *backendProxy) Dial(ctx context.Context) (net.Conn, error) {
+	conn, err := p.dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil && ctx.Err() == nil && p.onError != nil {
+		p.onError(p.address, err)
+	}
+	return conn, err
+}
@@ -0,0 +1,95 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/pigeonligh/srp/pkg/proxy"
+)
+
+type ProxyProtocolVersion int
+
+const (
+	ProxyProtocolV1 ProxyProtocolVersion = 1
+	ProxyProtocolV2 ProxyProtocolVersion = 2
+)
+
+// WithProxyProtocol 在连接后端后先写入 HAProxy PROXY protocol 头，携带 SSH 客户端的源地址和服务端的目的地址
+func WithProxyProtocol(inner proxy.ProxyProvider, version ProxyProtocolVersion) proxy.ProxyProvider {
+	return proxy.ProxyProviderFunc(func(ctx context.Context, target string) (proxy.Proxy, error) {
+		p, err := inner.ProxyProvide(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+
+		src, _ := ctx.Value(ssh.ContextKeyRemoteAddr).(net.Addr)
+		dst, _ := ctx.Value(ssh.ContextKeyLocalAddr).(net.Addr)
+		header := proxyProtocolHeader(version, src, dst)
+		return proxy.ProxyFunc(func(ctx context.Context) (net.Conn, error) {
+			conn, err := p.Dial(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := conn.Write(header); err != nil {
+				_ = conn.Close()
+				return nil, fmt.Errorf("write proxy protocol header: %w", err)
+			}
+			return conn, nil
+		}), nil
+	})
+}
+
+func ProxyProtocolMiddleware(version ProxyProtocolVersion) proxy.ProviderMiddleware {
+	return func(inner proxy.ProxyProvider) proxy.ProxyProvider {
+		return WithProxyProtocol(inner, version)
+	}
+}
+
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+func proxyProtocolHeader(version ProxyProtocolVersion, src, dst net.Addr) []byte {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	var srcIP, dstIP net.IP
+	if ok1 && ok2 {
+		srcIP, dstIP = srcTCP.IP.To4(), dstTCP.IP.To4()
+		if srcIP == nil || dstIP == nil {
+			srcIP, dstIP = srcTCP.IP.To16(), dstTCP.IP.To16()
+		}
+	}
+	known := srcIP != nil && dstIP != nil
+
+	if version == ProxyProtocolV1 {
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		family := "TCP4"
+		if len(srcIP) == net.IPv6len {
+			family = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %v %v %v %v %v\r\n", family, srcIP, dstIP, srcTCP.Port, dstTCP.Port))
+	}
+
+	var buf bytes.Buffer
+	buf.Write(proxyProtocolV2Signature)
+	if !known {
+		// LOCAL 命令，后端使用连接自身的地址
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buf.Bytes()
+	}
+	family := byte(0x11) // TCP over IPv4
+	if len(srcIP) == net.IPv6len {
+		family = 0x21 // TCP over IPv6
+	}
+	buf.Write([]byte{0x21, family})
+	_ = binary.Write(&buf, binary.BigEndian, uint16(2*len(srcIP)+4))
+	buf.Write(srcIP)
+	buf.Write(dstIP)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(srcTCP.Port))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(dstTCP.Port))
+	return buf.Bytes()
+}
@@ -9,15 +9,59 @@ import (
 
 	"github.com/pigeonligh/srp/pkg/nets"
 	"github.com/pigeonligh/srp/pkg/proxy"
+	"github.com/pigeonligh/srp/pkg/reverseproxy"
 )
 
+var (
+	DefaultSocketDialRetries       = 3
+	DefaultSocketDialRetryInterval = 50 * time.Millisecond
+)
+
+type SocketOption func(*socketProvider)
+
+// WithSocketDialTimeout 限制每次 Dial 的总时间，包括等待 socket 就绪和重试的时间，为 0 时只受 Dial 传入的 ctx 限制
+func WithSocketDialTimeout(timeout time.Duration) SocketOption {
+	return func(p *socketProvider) {
+		p.dialTimeout = timeout
+	}
+}
+
+// WithSocketDialRetry 设置 socket 已存在但连接被拒绝时的重试次数和间隔，retries 为 0 时不重试
+func WithSocketDialRetry(retries int, interval time.Duration) SocketOption {
+	return func(p *socketProvider) {
+		p.retries = retries
+		p.retryInterval = interval
+	}
+}
+
+// WithSocketForwardRoute 在本实例没有 target 的转发时，通过 reverseproxy.ForwardLocator 查询转发所在的实例，
+// 并交给 route 连接该实例，同时 Ready 在其他实例存在转发时也返回 true，h 未实现 ForwardLocator 时不生效
+func WithSocketForwardRoute(route func(ctx context.Context, instance, target string) (proxy.Proxy, error)) SocketOption {
+	return func(p *socketProvider) {
+		p.route = route
+	}
+}
+
 type socketProvider struct {
-	h            nets.SocketHandler
-	waitInterval time.Duration
+	h             nets.SocketHandler
+	waitInterval  time.Duration
+	retries       int
+	retryInterval time.Duration
+	dialTimeout   time.Duration
+	route         func(ctx context.Context, instance, target string) (proxy.Proxy, error)
 }
 
-func SocketProvider(h nets.SocketHandler, waitInterval time.Duration) proxy.ProxyProvider {
-	return &socketProvider{h: h, waitInterval: waitInterval}
+func SocketProvider(h nets.SocketHandler, waitInterval time.Duration, options ...SocketOption) proxy.ProxyProvider {
+	p := &socketProvider{
+		h:             h,
+		waitInterval:  waitInterval,
+		retries:       DefaultSocketDialRetries,
+		retryInterval: DefaultSocketDialRetryInterval,
+	}
+	for _, o := range options {
+		o(p)
+	}
+	return p
 }
 
 func (p *socketProvider) ProxyProvide(ctx context.Context, target string) (proxy.Proxy, error) {
@@ -29,16 +73,63 @@ func (p *socketProvider) ProxyProvide(ctx context.Context, target string) (proxy
 	if !ok {
 		return nil, fmt.Errorf("invalid target: %v", target)
 	}
+	if instance, ok, err := p.lookupRemote(ctx, target, socket); err != nil {
+		return nil, err
+	} else if ok {
+		return p.route(ctx, instance, target)
+	}
 
 	ret := proxy.UnixSocket(socket)
+	if p.retries > 0 {
+		// 转发刚注册时 socket 文件已经存在，但 accept 循环可能还没有开始
+		ret = proxy.ProxyWithRetry(ret, func(ctx context.Context) bool {
+			return p.h.SocketAlive(socket)
+		}, p.retries, p.retryInterval)
+	}
 	if p.waitInterval > 0 {
 		ret = proxy.ProxyWithReadiness(ret, func(ctx context.Context) bool {
 			return p.h.SocketAlive(socket)
 		}, p.waitInterval)
 	}
+	if p.dialTimeout > 0 {
+		ret = proxy.ProxyWithTimeout(ret, p.dialTimeout)
+	}
 	return ret, nil
 }
 
+func (p *socketProvider) Ready(ctx context.Context, target string) bool {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return false
+	}
+	socket, ok := p.h.ConvertHostPortToSocket(host, port)
+	if !ok {
+		return false
+	}
+	if p.h.SocketAlive(socket) {
+		return true
+	}
+	_, ok, _ = p.lookupRemote(ctx, target, socket)
+	return ok
+}
+
+// lookupRemote 返回提供 target 的其他实例，只在设置了 WithSocketForwardRoute 且本地没有转发时查询
+func (p *socketProvider) lookupRemote(ctx context.Context, target, socket string) (string, bool, error) {
+	locator, ok := p.h.(reverseproxy.ForwardLocator)
+	if p.route == nil || !ok || p.h.SocketAlive(socket) {
+		return "", false, nil
+	}
+	instance, ok, err := locator.LookupForward(ctx, target)
+	if err != nil {
+		return "", false, fmt.Errorf("lookup forward %v: %w", target, err)
+	}
+	// LookupForward 检查之后本地可能已经建立了转发
+	if !ok || p.h.SocketAlive(socket) {
+		return "", false, nil
+	}
+	return instance, true, nil
+}
+
 type SocketFile string
 
 func (f SocketFile) ConvertHostPortToSocket(host, port string) (string, bool) {
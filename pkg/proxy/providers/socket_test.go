@@ -0,0 +1,119 @@
+//go:build linux
+
+package providers
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/proxy"
+)
+
+// stalledSocket 返回一个从不 accept 且 backlog 已满的 unix socket
+func stalledSocket(t *testing.T) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "stalled.sock")
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = syscall.Close(fd) })
+	if err := syscall.Bind(fd, &syscall.SockaddrUnix{Name: socket}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 16; i++ {
+		conn, err := net.DialTimeout("unix", socket, 100*time.Millisecond)
+		if err != nil {
+			return socket
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+	}
+	t.Skip("backlog of the socket is never full")
+	return ""
+}
+
+func TestSocketProviderStalledAccept(t *testing.T) {
+	socket := stalledSocket(t)
+
+	tests := []struct {
+		name    string
+		options []SocketOption
+		timeout time.Duration
+	}{
+		{"dial timeout", []SocketOption{WithSocketDialTimeout(100 * time.Millisecond), WithSocketDialRetry(1000, 10*time.Millisecond)}, 0},
+		{"caller cancel", []SocketOption{WithSocketDialRetry(1000, 10*time.Millisecond)}, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := SocketProvider(SocketFile(socket), 0, tt.options...).ProxyProvide(context.Background(), "example.com:80")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			conn, err := p.Dial(ctx)
+			if err == nil {
+				_ = conn.Close()
+				t.Fatal("dial to a stalled socket should fail")
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("dial returned after %v: %v", elapsed, err)
+			}
+		})
+	}
+}
+
+type remoteForwards struct {
+	SocketNamer
+	instances map[string]string
+}
+
+func (r remoteForwards) LookupForward(_ context.Context, target string) (string, bool, error) {
+	instance, ok := r.instances[target]
+	return instance, ok, nil
+}
+
+func TestSocketProviderForwardRoute(t *testing.T) {
+	h := remoteForwards{
+		SocketNamer: func(host, port string) string { return filepath.Join(t.TempDir(), host+".sock") },
+		instances:   map[string]string{"web:80": "b"},
+	}
+	var routed string
+	route := func(_ context.Context, instance, target string) (proxy.Proxy, error) {
+		routed = instance + "/" + target
+		return proxy.Direct("tcp", target), nil
+	}
+
+	p := SocketProvider(h, 0, WithSocketForwardRoute(route))
+	if _, err := p.ProxyProvide(context.Background(), "web:80"); err != nil {
+		t.Fatal(err)
+	}
+	if routed != "b/web:80" {
+		t.Fatalf("routed = %q, want b/web:80", routed)
+	}
+	if !p.(proxy.ReadinessChecker).Ready(context.Background(), "web:80") {
+		t.Fatal("target forwarded by another instance should be ready")
+	}
+	if p.(proxy.ReadinessChecker).Ready(context.Background(), "api:80") {
+		t.Fatal("target without forward should not be ready")
+	}
+
+	// 没有设置 WithSocketForwardRoute 时只使用本地的 socket
+	routed = ""
+	if _, err := SocketProvider(h, 0).ProxyProvide(context.Background(), "web:80"); err != nil || routed != "" {
+		t.Fatalf("ProxyProvide = %v, routed = %q", err, routed)
+	}
+}
@@ -0,0 +1,93 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/proxy"
+)
+
+type TCPOption func(*tcpProvider)
+
+// WithTCPLocalAddr 设置连接目标时绑定的源地址，如 "10.0.0.2" 或 "10.0.0.2:0"
+func WithTCPLocalAddr(addr string) TCPOption {
+	return func(p *tcpProvider) {
+		p.localAddr = addr
+	}
+}
+
+// WithTCPKeepAlive 设置 TCP keepalive 的间隔，为负数时关闭 keepalive
+func WithTCPKeepAlive(interval time.Duration) TCPOption {
+	return func(p *tcpProvider) {
+		p.dialer.KeepAlive = interval
+	}
+}
+
+// WithTCPNoDelay 设置 TCP_NODELAY，Go 默认开启
+func WithTCPNoDelay(noDelay bool) TCPOption {
+	return func(p *tcpProvider) {
+		p.noDelay = &noDelay
+	}
+}
+
+func WithTCPDialTimeout(timeout time.Duration) TCPOption {
+	return func(p *tcpProvider) {
+		p.dialer.Timeout = timeout
+	}
+}
+
+// WithTCPControl 在连接前对 socket 调用 control，可以设置 SO_MARK、SO_RCVBUF 等选项
+func WithTCPControl(control func(network, address string, c syscall.RawConn) error) TCPOption {
+	return func(p *tcpProvider) {
+		p.dialer.Control = control
+	}
+}
+
+type tcpProvider struct {
+	dialer    net.Dialer
+	localAddr string
+	noDelay   *bool
+}
+
+// TCPProviderWithOptions 与 TCPProvider 相同，但可以设置源地址、keepalive 等连接参数，
+// WithTCPLocalAddr 设置的地址无效时返回错误
+func TCPProviderWithOptions(options ...TCPOption) (proxy.ProxyProvider, error) {
+	p := &tcpProvider{}
+	for _, o := range options {
+		o(p)
+	}
+	if p.localAddr != "" {
+		addr, err := resolveLocalTCPAddr(p.localAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local address %q: %w", p.localAddr, err)
+		}
+		p.dialer.LocalAddr = addr
+	}
+	return p, nil
+}
+
+func resolveLocalTCPAddr(addr string) (*net.TCPAddr, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "0")
+	}
+	return net.ResolveTCPAddr("tcp", addr)
+}
+
+func (p *tcpProvider) ProxyProvide(ctx context.Context, target string) (proxy.Proxy, error) {
+	return proxy.ProxyFunc(func(ctx context.Context) (net.Conn, error) {
+		conn, err := p.dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return nil, err
+		}
+		if tc, ok := conn.(*net.TCPConn); ok && p.noDelay != nil {
+			if err := tc.SetNoDelay(*p.noDelay); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}), nil
+}
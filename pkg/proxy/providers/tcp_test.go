@@ -0,0 +1,96 @@
+//go:build linux
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// blackholeAddr 返回一个不会完成握手的地址：backlog 为 0 且从不 accept，队列被占满后新的 SYN 会被丢弃
+func blackholeAddr(t *testing.T) string {
+	t.Helper()
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = syscall.Close(fd) })
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := (&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}).String()
+
+	for i := 0; i < 16; i++ {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err != nil {
+			return addr
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+	}
+	t.Skip("backlog of the listener is never full")
+	return ""
+}
+
+func TestTCPProviderCancelDial(t *testing.T) {
+	addr := blackholeAddr(t)
+
+	tests := map[string]func(context.Context, string) (net.Conn, error){
+		"TCPProvider": func(ctx context.Context, target string) (net.Conn, error) {
+			p, err := TCPProvider.ProxyProvide(ctx, target)
+			if err != nil {
+				return nil, err
+			}
+			return p.Dial(ctx)
+		},
+		"TCPProviderWithOptions": func(ctx context.Context, target string) (net.Conn, error) {
+			provider, err := TCPProviderWithOptions(WithTCPKeepAlive(-1))
+			if err != nil {
+				return nil, err
+			}
+			p, err := provider.ProxyProvide(ctx, target)
+			if err != nil {
+				return nil, err
+			}
+			return p.Dial(ctx)
+		},
+	}
+	for name, dial := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			start := time.Now()
+			conn, err := dial(ctx, addr)
+			if err == nil {
+				_ = conn.Close()
+				t.Fatal("dial to a non-responsive address should fail")
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("err = %v, want context.Canceled", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("dial returned after %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestTCPProviderWithOptionsInvalidLocalAddr(t *testing.T) {
+	if _, err := TCPProviderWithOptions(WithTCPLocalAddr("not an address:x")); err == nil {
+		t.Fatal("invalid local address should fail at construction")
+	}
+	if _, err := TCPProviderWithOptions(WithTCPLocalAddr("127.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+}
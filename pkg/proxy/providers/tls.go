@@ -0,0 +1,95 @@
+package providers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/pigeonligh/srp/pkg/nets"
+	"github.com/pigeonligh/srp/pkg/proxy"
+)
+
+type TLSOption func(*tlsWrapper)
+
+// WithTLSInsecureSkipVerify 不校验后端证书，用于内部 CA 签发的证书
+func WithTLSInsecureSkipVerify() TLSOption {
+	return func(w *tlsWrapper) {
+		w.config.InsecureSkipVerify = true
+	}
+}
+
+// WithTLSClientCertificate 向要求 mTLS 的后端出示客户端证书
+func WithTLSClientCertificate(cert tls.Certificate) TLSOption {
+	return func(w *tlsWrapper) {
+		w.config.Certificates = append(w.config.Certificates, cert)
+	}
+}
+
+// WithTLSNetDialer 设置 TLSProvider 连接后端使用的 dialer，对 TLSMiddleware 无效
+func WithTLSNetDialer(d nets.NetDialer) TLSOption {
+	return func(w *tlsWrapper) {
+		w.dialer = d
+	}
+}
+
+type tlsWrapper struct {
+	config *tls.Config
+	dialer nets.NetDialer
+}
+
+func newTLSWrapper(config *tls.Config, options []TLSOption) *tlsWrapper {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	w := &tlsWrapper{
+		config: config.Clone(),
+		dialer: nets.DefaultNetDialer,
+	}
+	for _, opt := range options {
+		opt(w)
+	}
+	return w
+}
+
+// TLSProvider 连接目标后进行 TLS 握手，config 中未指定 ServerName 时使用目标的主机名
+func TLSProvider(config *tls.Config, options ...TLSOption) proxy.ProxyProvider {
+	w := newTLSWrapper(config, options)
+	return w.wrap(NetDialerProvider(w.dialer))
+}
+
+// TLSMiddleware 在 inner 建立的连接上进行 TLS 握手
+func TLSMiddleware(config *tls.Config, options ...TLSOption) proxy.ProviderMiddleware {
+	return newTLSWrapper(config, options).wrap
+}
+
+func (w *tlsWrapper) wrap(inner proxy.ProxyProvider) proxy.ProxyProvider {
+	return proxy.ProxyProviderFunc(func(ctx context.Context, target string) (proxy.Proxy, error) {
+		host, _, err := net.SplitHostPort(target)
+		if err != nil {
+			return nil, err
+		}
+		p, err := inner.ProxyProvide(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+
+		config := w.config
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName = host
+		}
+		return proxy.ProxyFunc(func(ctx context.Context) (net.Conn, error) {
+			conn, err := p.Dial(ctx)
+			if err != nil {
+				return nil, err
+			}
+			tlsConn := tls.Client(conn, config)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				_ = conn.Close()
+				return nil, fmt.Errorf("tls handshake with %v: %w", target, err)
+			}
+			return tlsConn, nil
+		}), nil
+	})
+}
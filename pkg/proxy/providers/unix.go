@@ -0,0 +1,36 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pigeonligh/srp/pkg/proxy"
+)
+
+// UnixTargetPrefix 为指向 unix socket 的目标前缀，如 unix:/var/run/app.sock
+const UnixTargetPrefix = "unix:"
+
+type unixProvider struct {
+	fallback proxy.ProxyProvider
+}
+
+// UnixSocketProvider 连接后端主机上的 unix socket，目标必须为 unix:/path/to.sock，其他目标返回错误，
+// 通常与 TargetResolver 配合，将 host:port 形式的别名映射为 socket
+var UnixSocketProvider proxy.ProxyProvider = unixProvider{}
+
+// UnixTargetProvider 将 unix: 开头的目标交给 UnixSocketProvider，其他目标交给 fallback
+func UnixTargetProvider(fallback proxy.ProxyProvider) proxy.ProxyProvider {
+	return unixProvider{fallback: fallback}
+}
+
+func (p unixProvider) ProxyProvide(ctx context.Context, target string) (proxy.Proxy, error) {
+	socket, ok := strings.CutPrefix(target, UnixTargetPrefix)
+	if !ok && p.fallback != nil {
+		return p.fallback.ProxyProvide(ctx, target)
+	}
+	if !ok || socket == "" {
+		return nil, fmt.Errorf("invalid unix target: %v", target)
+	}
+	return proxy.UnixSocket(socket), nil
+}
@@ -0,0 +1,32 @@
+package providers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pigeonligh/srp/pkg/proxy"
+)
+
+func TestUnixSocketProvider(t *testing.T) {
+	fallback := UnixTargetProvider(TCPProvider)
+
+	tests := []struct {
+		provider proxy.ProxyProvider
+		target   string
+		wantErr  bool
+	}{
+		{UnixSocketProvider, "unix:/run/app.sock", false},
+		{UnixSocketProvider, "unix:", true},
+		// 没有 fallback 时不把 host:port 当作 socket 路径
+		{UnixSocketProvider, "web:80", true},
+		{UnixSocketProvider, "/run/app.sock", true},
+		{fallback, "unix:/run/app.sock", false},
+		{fallback, "web:80", false},
+	}
+	for _, tt := range tests {
+		_, err := tt.provider.ProxyProvide(context.Background(), tt.target)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ProxyProvide(%q) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+		}
+	}
+}
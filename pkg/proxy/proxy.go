@@ -2,7 +2,9 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"net"
+	"syscall"
 	"time"
 
 	"github.com/pigeonligh/srp/pkg/nets"
@@ -30,18 +32,24 @@ func DirectWithDialer(network string, address string, dialer nets.NetDialer) Pro
 	return directProxy{network: network, address: address, dialer: dialer}
 }
 
+// UnixSocket 连接 unix socket，Dial 遵循传入 ctx 的取消和超时
 func UnixSocket(socket string) Proxy {
 	return Direct("unix", socket)
 }
 
-type funcProxy func(ctx context.Context) (net.Conn, error)
+// UnixSocketWithTimeout 与 UnixSocket 相同，但每次 Dial 最多等待 timeout
+func UnixSocketWithTimeout(socket string, timeout time.Duration) Proxy {
+	return ProxyWithTimeout(UnixSocket(socket), timeout)
+}
+
+type ProxyFunc func(ctx context.Context) (net.Conn, error)
 
-func (f funcProxy) Dial(ctx context.Context) (net.Conn, error) {
+func (f ProxyFunc) Dial(ctx context.Context) (net.Conn, error) {
 	return f(ctx)
 }
 
 func ProxyWithTimeout(p Proxy, timeout time.Duration) Proxy {
-	return funcProxy(func(ctx context.Context) (net.Conn, error) {
+	return ProxyFunc(func(ctx context.Context) (net.Conn, error) {
 		ctx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
 		return p.Dial(ctx)
@@ -57,7 +65,7 @@ func ProxyWithReadiness(p Proxy, readiness func(context.Context) bool, interval
 				select {
 				case <-ctx.Done():
 					t.Stop()
-					return context.Canceled
+					return ctx.Err()
 
 				case <-t.C:
 					if readiness(ctx) {
@@ -71,10 +79,34 @@ func ProxyWithReadiness(p Proxy, readiness func(context.Context) bool, interval
 		return nil
 	}
 
-	return funcProxy(func(ctx context.Context) (net.Conn, error) {
+	return ProxyFunc(func(ctx context.Context) (net.Conn, error) {
 		if err := wait(ctx); err != nil {
 			return nil, err
 		}
 		return p.Dial(ctx)
 	})
 }
+
+// ProxyWithRetry 在连接被拒绝（ECONNREFUSED）或 unix socket 的 backlog 已满（EAGAIN）但 readiness 认为目标已经存在时，
+// 每隔 interval 重试，最多重试 retries 次，用于转发刚注册、accept 循环尚未就绪或暂时阻塞时到达的连接
+func ProxyWithRetry(p Proxy, readiness func(context.Context) bool, retries int, interval time.Duration) Proxy {
+	return ProxyFunc(func(ctx context.Context) (net.Conn, error) {
+		conn, err := p.Dial(ctx)
+		for i := 0; i < retries && err != nil; i++ {
+			if !isTemporaryDialError(err) || !readiness(ctx) {
+				return nil, err
+			}
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(interval):
+			}
+			conn, err = p.Dial(ctx)
+		}
+		return conn, err
+	})
+}
+
+func isTemporaryDialError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EAGAIN)
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/pigeonligh/srp/pkg/auth"
+)
+
+// TargetResolver 在调用 ProxyProvide 之前改写目标地址，如将别名映射为内部的 host:port，
+// 返回错误时拒绝该连接
+type TargetResolver interface {
+	Resolve(ctx context.Context, target string) (string, error)
+}
+
+type TargetResolverFunc func(ctx context.Context, target string) (string, error)
+
+func (f TargetResolverFunc) Resolve(ctx context.Context, target string) (string, error) {
+	return f(ctx, target)
+}
+
+// StaticTargets 将 map 中存在的目标替换为对应的值，其他目标保持不变
+type StaticTargets map[string]string
+
+func (m StaticTargets) Resolve(ctx context.Context, target string) (string, error) {
+	if resolved, ok := m[target]; ok {
+		return resolved, nil
+	}
+	return target, nil
+}
+
+// TenantResolver 将目标放到用户所属租户的命名空间下，如租户 acme 的用户访问 web:80 时改写为 acme.web:80，
+// 已经位于命名空间下的目标保持不变，不属于任何租户的用户和 IP 地址的目标返回错误
+func TenantResolver(m auth.TenantMapper) TargetResolver {
+	return TargetResolverFunc(func(ctx context.Context, target string) (string, error) {
+		user, _ := UserFromContext(ctx)
+		ns, ok := m.Tenant(ctx, user)
+		if !ok {
+			return "", fmt.Errorf("user %v does not belong to any tenant", user)
+		}
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return "", err
+		}
+		if _, err := netip.ParseAddr(host); err == nil {
+			return "", fmt.Errorf("user %v in tenant %v can not access ip address %v", user, ns, host)
+		}
+		if !auth.InTenant(host, ns) {
+			host = ns + "." + host
+		}
+		return net.JoinHostPort(host, port), nil
+	})
+}
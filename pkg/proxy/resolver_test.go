@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pigeonligh/srp/pkg/auth"
+)
+
+func TestTenantResolver(t *testing.T) {
+	resolver := TenantResolver(auth.StaticTenants{"alice": "acme", "carol": "10"})
+
+	tests := []struct {
+		user    string
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{"alice", "web:80", "acme.web:80", false},
+		{"alice", "acme.web:80", "acme.web:80", false},
+		{"alice", "ACME.web:80", "ACME.web:80", false},
+		{"alice", "other.web:80", "acme.other.web:80", false},
+		{"carol", "10.0.0.1:22", "", true},
+		{"carol", "web:80", "10.web:80", false},
+		{"alice", "[::1]:22", "", true},
+		{"dave", "web:80", "", true},
+	}
+	for _, tt := range tests {
+		ctx := ContextWithConnMetadata(context.Background(), tt.user, "", nil)
+		got, err := resolver.Resolve(ctx, tt.target)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Resolve(%q, %q) = %q, %v, want %q", tt.user, tt.target, got, err, tt.want)
+		}
+	}
+}
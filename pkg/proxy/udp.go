@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/pigeonligh/srp/pkg/nets"
+	"github.com/pigeonligh/srp/pkg/protocol"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func (h *handler) HandleUDPProxy(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+	h.logger.Infof("Handle %v for user %v in %v", protocol.DirectUDPChannelType, ctx.User(), ctx.SessionID())
+	h.callbacks.OnHandleProxy(ctx)
+	defer h.callbacks.OnHandleProxyDone(ctx)
+
+	var payload protocol.DirectPayload
+	err := gossh.Unmarshal(newChan.ExtraData(), &payload)
+	if err != nil {
+		h.logger.Errorf("Cannot accept extra data for %v: %v", ctx.SessionID(), err)
+		if rejectErr := newChan.Reject(gossh.ConnectionFailed, "invalid direct-udp payload"); rejectErr != nil {
+			h.logger.Errorf("Cannot reject channel for %v: %v", ctx.SessionID(), rejectErr)
+		}
+		return
+	}
+	h.logger.Infof("UDP payload for session %v: %v", ctx.SessionID(), payload)
+
+	proxy, err := h.getProxy(ctx, h.udpProvider, "udp", net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port)))
+	if err != nil {
+		rejectErr := newChan.Reject(gossh.Prohibited, fmt.Sprintf("Cannot get udp proxy for session %v: %v", ctx.SessionID(), err))
+		if rejectErr != nil {
+			h.logger.Errorf("Cannot reject channel for %v: %v", ctx.SessionID(), rejectErr)
+		}
+
+		h.callbacks.OnProxyCreateFailed(ctx, payload, err)
+		h.logger.Errorf("Cannot create udp proxy for %v: %v", ctx.SessionID(), err)
+		return
+	}
+	h.callbacks.OnProxyCreated(ctx, payload)
+
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		h.callbacks.OnProxyChannelAcceptFailed(ctx, payload, err)
+		h.logger.Errorf("Cannot accept channel for %v: %v", ctx.SessionID(), err)
+		return
+	}
+	defer ch.Close()
+	go gossh.DiscardRequests(reqs)
+	h.callbacks.OnProxyChannelAccepted(ctx, payload)
+
+	c, err := proxy.Dial(ctx)
+	if err != nil {
+		h.callbacks.OnProxyDialFailed(ctx, payload, err)
+		h.logger.Errorf("Cannot dial udp proxy for %v: %v", ctx.SessionID(), err)
+		return
+	}
+	h.callbacks.OnProxyDialed(ctx, payload)
+	err = nets.HandleDatagrams(ch, c)
+	h.callbacks.OnProxyConnectionDone(ctx, payload, err)
+	if err != nil {
+		h.logger.Errorf("Cannot handle udp proxy for %v: %v", ctx.SessionID(), err)
+		return
+	}
+	h.logger.Infof("UDP proxy done for session %v.", ctx.SessionID())
+}
@@ -0,0 +1,48 @@
+package reverseproxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// DenyReason 为转发请求被拒绝的原因
+type DenyReason string
+
+const (
+	DenyUnauthenticated DenyReason = "unauthenticated"
+	DenyUnauthorized    DenyReason = "unauthorized"
+	DenyInvalidRequest  DenyReason = "invalid_request"
+	DenyUnavailable     DenyReason = "unavailable"
+	// 以下为监听失败时更具体的原因
+	DenyAddressInUse     DenyReason = "address_in_use"
+	DenyPermissionDenied DenyReason = "permission_denied"
+	DenyNoSpace          DenyReason = "no_space"
+)
+
+type DeniedError struct {
+	Reason DenyReason
+	Err    error
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Reason, e.Err)
+}
+
+func (e *DeniedError) Unwrap() error {
+	return e.Err
+}
+
+// listenDenyReason 区分监听失败的原因，如 unixDirectory 不可写或磁盘已满时不会被误认为地址已被占用
+func listenDenyReason(err error) DenyReason {
+	switch {
+	case errors.Is(err, syscall.EADDRINUSE):
+		return DenyAddressInUse
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, syscall.EROFS):
+		return DenyPermissionDenied
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return DenyNoSpace
+	}
+	return DenyUnavailable
+}
@@ -2,47 +2,85 @@ package reverseproxy
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
 	"net"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/pigeonligh/srp/pkg/auth"
+	"github.com/pigeonligh/srp/pkg/clock"
+	"github.com/pigeonligh/srp/pkg/events"
+	"github.com/pigeonligh/srp/pkg/logger"
+	"github.com/pigeonligh/srp/pkg/metrics"
 	"github.com/pigeonligh/srp/pkg/nets"
 	"github.com/pigeonligh/srp/pkg/protocol"
-	"github.com/sirupsen/logrus"
 	gossh "golang.org/x/crypto/ssh"
 )
 
 type Handler interface {
 	PasswordHandler() ssh.PasswordHandler
 	PublicKeyHandler() ssh.PublicKeyHandler
+	KeyboardInteractiveHandler() ssh.KeyboardInteractiveHandler
 
 	HandleSSHRequest(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte)
 
 	ConvertBindAddressToHostPort(bindAddress string) (string, string, bool)
+	ConvertHostPortToTCPListen(host, port string) (string, bool)
+	ConvertHostPortToSocket(host, port string) (string, bool)
+	SocketAlive(socket string) bool
 	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
 
 	ListProxies() []string
+	ActiveForwards() []ForwardInfo
 	AddEventHandler(EventHandler)
 }
 
+type ForwardInfo struct {
+	User        string
+	SessionID   string
+	Host        string
+	Port        string
+	BindAddress string
+	Connections int64
+}
+
 type ld struct {
 	l net.Listener
 	d nets.NetDialer
+	// 停止 accept 循环，关闭 l 时需要一起调用
+	stop context.CancelFunc
+
+	user        string
+	bindAddress string
+	conns       atomic.Int64
+
+	// 非空时表示转发来自 tcpip-forward 请求，连接通过 forwarded-tcpip channel 转发给客户端
+	tcpip *protocol.TCPIPForwardRequest
+
+	// 最近一次按连接授权的结果，见 WithConnectionAuthorization
+	authMutex   sync.Mutex
+	authAt      time.Time
+	authAllowed bool
 }
 
 type proxy struct {
 	host   string
 	port   string
 	errCnt int
-	lds    map[string]ld // sessionID => ld
+	lds    map[string]*ld // sessionID => ld
 	mutex  sync.Mutex
 }
 
-func (p *proxy) addLD(sessionID string, l net.Listener, d nets.NetDialer) error {
+func (p *proxy) addLD(sessionID string, f *ld) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 	if len(p.lds) > 16 {
@@ -57,19 +95,36 @@ func (p *proxy) addLD(sessionID string, l net.Listener, d nets.NetDialer) error
 		}
 	}
 	p.errCnt = 0
-	p.lds[sessionID] = ld{l: l, d: d}
+	p.lds[sessionID] = f
 	return nil
 }
 
-func (p *proxy) removeLD(sessionID string) bool {
+func (p *proxy) removeLD(sessionID string, f *ld) (*ld, bool) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	_, ok := p.lds[sessionID]
-	if ok {
+	ld, ok := p.lds[sessionID]
+	if ok && (f == nil || ld == f) {
+		// 关闭 listener 以停止接收新连接，已有连接在 serveForward 中等待结束
+		_ = ld.l.Close()
+		if ld.stop != nil {
+			ld.stop()
+		}
 		delete(p.lds, sessionID)
+	} else {
+		ld = nil
 	}
 	p.errCnt = 0
-	return len(p.lds) == 0
+	return ld, len(p.lds) == 0
+}
+
+func (p *proxy) owners() map[string]*ld {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ret := make(map[string]*ld, len(p.lds))
+	for sessionID, ld := range p.lds {
+		ret[sessionID] = ld
+	}
+	return ret
 }
 
 func (p *proxy) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -90,44 +145,136 @@ func (p *proxy) DialContext(ctx context.Context, network, addr string) (net.Conn
 }
 
 type handler struct {
-	authenticator auth.Authenticator
-	authorizer    auth.Authorizer
-	unixDirectory string
+	logger          logger.Logger
+	authenticator   auth.Authenticator
+	kiAuthenticator auth.KeyboardInteractiveAuthenticator
+	authMethods     map[string]bool
+	authorizer      auth.Authorizer
+	unixDirectory   string
+	drainTimeout    time.Duration
+	idleTimeout     time.Duration
+	copyBufferSize  int
+	clock           clock.Clock
+
+	connectionAuthTTL       time.Duration
+	revocationCheckInterval time.Duration
+
+	listenMode         ListenMode
+	tcpListenConverter TCPListenConverter
+	socketFileMode     os.FileMode
+	socketOwnerUID     int
+	socketOwnerGID     int
+
+	onTransfer nets.TransferFunc
+
+	maxForwardsPerUser       int
+	maxConnectionsPerForward int
+	replaceExistingForward   bool
+	cleanupStaleSockets      bool
 
 	// forwards map[string]net.Listener // uid => listener
-	proxies map[string]*proxy // host:port => proxy
+	proxies      map[string]*proxy       // host:port => proxy
+	dynamicPorts map[string]*dynamicPort // host:port => 预留的动态端口
+	userForwards map[string]int          // user => forwards
+	closed       bool
 	sync.Mutex
 
+	// unixDirectory 是否为 NewWithOptions 自动创建的临时目录，Close 时删除
+	tempDirectory bool
+
+	serving sync.WaitGroup
+
 	eventHandlers EventHandlers
+	events        events.Events
+
+	registry        ForwardRegistry
+	instance        string
+	registryTTL     time.Duration
+	registryNotify  chan struct{}
+	registryDone    chan struct{}
+	registryStopped chan struct{}
 }
 
 func New(authenticator auth.Authenticator, authorizer auth.Authorizer, unixDirectory string) (Handler, error) {
-	if unixDirectory == "" {
+	return NewWithOptions(
+		WithAuthenticator(authenticator),
+		WithAuthorizer(authorizer),
+		WithUnixDirectory(unixDirectory),
+	)
+}
+
+func NewWithOptions(options ...Option) (Handler, error) {
+	h := &handler{
+		logger:              logger.Default(),
+		clock:               clock.Real,
+		cleanupStaleSockets: true,
+		socketOwnerUID:      -1,
+		socketOwnerGID:      -1,
+
+		// forwards: make(map[string]net.Listener),
+		proxies:      make(map[string]*proxy),
+		dynamicPorts: make(map[string]*dynamicPort),
+		userForwards: make(map[string]int),
+
+		eventHandlers: make(EventHandlers, 0),
+	}
+	for _, opt := range options {
+		opt(h)
+	}
+	if h.authMethods != nil {
+		if err := auth.CheckMethods(h.authMethods); err != nil {
+			return nil, err
+		}
+	}
+	if h.registry != nil {
+		if h.registryTTL == 0 {
+			h.registryTTL = DefaultForwardRegistryTTL
+		}
+		// 每隔三分之一租期续约，过短的租期无法及时续约
+		if h.registryTTL < MinForwardRegistryTTL {
+			return nil, fmt.Errorf("forward registry ttl %v is shorter than %v", h.registryTTL, MinForwardRegistryTTL)
+		}
+	}
+
+	if h.unixDirectory == "" {
 		dir, err := os.MkdirTemp("", "srp")
 		if err != nil {
 			return nil, err
 		}
-		unixDirectory = dir
+		h.unixDirectory = dir
+		h.tempDirectory = true
 	} else {
-		err := os.MkdirAll(unixDirectory, os.ModePerm)
+		err := os.MkdirAll(h.unixDirectory, os.ModePerm)
 		if err != nil {
 			return nil, err
 		}
+		if h.cleanupStaleSockets {
+			if err := cleanupStaleSockets(h.unixDirectory, h.logger); err != nil {
+				return nil, err
+			}
+		}
 	}
+	if err := checkSocketDirectory(h.unixDirectory, h.listenMode == ListenModeUnix); err != nil {
+		return nil, err
+	}
+	if h.registry != nil {
+		h.registryNotify = make(chan struct{}, 1)
+		h.registryDone = make(chan struct{})
+		h.registryStopped = make(chan struct{})
+		go h.runRegistry()
+	}
+	return h, nil
+}
 
-	return &handler{
-		authenticator: authenticator,
-		authorizer:    authorizer,
-		unixDirectory: unixDirectory,
-
-		// forwards: make(map[string]net.Listener),
-		proxies: make(map[string]*proxy),
-
-		eventHandlers: make(EventHandlers, 0),
-	}, nil
+func (h *handler) authMethodEnabled(method string) bool {
+	return h.authMethods == nil || h.authMethods[method]
 }
 
+// PasswordHandler 未启用密码认证时返回 nil
 func (h *handler) PasswordHandler() ssh.PasswordHandler {
+	if !h.authMethodEnabled(auth.MethodPassword) {
+		return nil
+	}
 	return func(ctx ssh.Context, password string) bool {
 		var ret bool
 		if h.authenticator == nil {
@@ -146,7 +293,11 @@ func (h *handler) PasswordHandler() ssh.PasswordHandler {
 	}
 }
 
+// PublicKeyHandler 未启用公钥认证时返回 nil
 func (h *handler) PublicKeyHandler() ssh.PublicKeyHandler {
+	if !h.authMethodEnabled(auth.MethodPublicKey) {
+		return nil
+	}
 	return func(ctx ssh.Context, key ssh.PublicKey) bool {
 		var ret bool
 		if h.authenticator == nil {
@@ -165,21 +316,193 @@ func (h *handler) PublicKeyHandler() ssh.PublicKeyHandler {
 	}
 }
 
+// KeyboardInteractiveHandler 未设置 KeyboardInteractiveAuthenticator 时总是认证失败，未启用时返回 nil
+func (h *handler) KeyboardInteractiveHandler() ssh.KeyboardInteractiveHandler {
+	if !h.authMethodEnabled(auth.MethodKeyboardInteractive) {
+		return nil
+	}
+	return func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+		var ret bool
+		if h.kiAuthenticator != nil {
+			ret = h.kiAuthenticator.AuthenticateKeyboardInteractive(ctx, auth.KeyboardInteractiveRequest{
+				User:       ctx.User(),
+				Challenge:  challenger,
+				RemoteAddr: ctx.RemoteAddr(),
+				LocalAddr:  ctx.LocalAddr(),
+			})
+		}
+
+		ctx.SetValue(protocol.ContextKeyReverseProxyAuthed, ret)
+		return ret
+	}
+}
+
 func (h *handler) ConvertBindAddressToHostPort(bindAddress string) (string, string, bool) {
-	bindAddress = strings.TrimPrefix(bindAddress, "/")
-	host, portString, cut := strings.Cut(bindAddress, "/")
+	host, port, err := parseBindAddress(bindAddress)
+	return host, port, err == nil
+}
+
+// parseBindAddress 解析 /host/port 形式的 bindAddress，返回的错误说明了具体不合法的部分
+func parseBindAddress(bindAddress string) (string, string, error) {
+	host, portString, cut := strings.Cut(strings.TrimPrefix(bindAddress, "/"), "/")
 	if !cut {
-		return "", "", false
+		return "", "", fmt.Errorf("bind address %q is not in /host/port form", bindAddress)
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid port %q in bind address", portString)
 	}
-	port, _ := strconv.Atoi(portString)
-	if port <= 0 {
-		return "", "", false
+	// 拒绝 +80、080 等写法，同一个端口只能对应一个 target
+	if strconv.FormatUint(port, 10) != portString {
+		return "", "", fmt.Errorf("port %q in bind address is not in canonical form", portString)
 	}
-	return host, portString, true
+	host, ok := normalizeHost(host)
+	if !ok {
+		return "", "", fmt.Errorf("invalid IPv6 address %q in bind address", host)
+	}
+	if err := checkHost(host); err != nil {
+		return "", "", err
+	}
+	return host, portString, nil
 }
 
-func (h *handler) ProxyAlive(host, port string) bool {
+// checkHost 拒绝空的、过长的或可能被当作路径的 host，host 会被用于生成 socket 文件名
+func checkHost(host string) error {
+	if host == "" {
+		return fmt.Errorf("empty host in bind address")
+	}
+	if len(host) > 253 {
+		return fmt.Errorf("host in bind address is too long (%v > 253 bytes)", len(host))
+	}
+	if strings.Contains(host, "..") {
+		return fmt.Errorf("host %q in bind address contains \"..\"", host)
+	}
+	for _, r := range host {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("host %q in bind address contains control character %U", host, r)
+		}
+		if r == '/' || r == '\\' {
+			return fmt.Errorf("host %q in bind address contains path separator %q", host, r)
+		}
+	}
+	return nil
+}
+
+// normalizeHost 去掉 IPv6 地址的方括号并转为标准形式，保证 net.JoinHostPort 得到一致的 target
+func normalizeHost(host string) (string, bool) {
+	bracketed := strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]")
+	if bracketed {
+		host = host[1 : len(host)-1]
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.String(), true
+	}
+	// 方括号中只能是 IPv6 地址
+	return host, !bracketed
+}
+
+// 端口为 0 的转发请求由服务端分配一个当前未被使用的端口
+const (
+	dynamicPortMin = 49152
+	dynamicPortMax = 65535
+)
+
+// dynamicPort 为端口 0 的转发请求预留的端口，在转发结束前其他 session 不能使用
+type dynamicPort struct {
+	sessionID string
+
+	// TCP 模式下分配端口时已经建立的监听，由 addProxy 接管
+	l net.Listener
+	d nets.NetDialer
+}
+
+// allocatePort 在锁内预留 host 上的一个端口，TCP 模式下监听 0 端口并使用系统分配的端口
+func (h *handler) allocatePort(host, sessionID string) (string, error) {
+	if h.listenMode == ListenModeTCP {
+		return h.allocateTCPPort(host, sessionID)
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	n := dynamicPortMax - dynamicPortMin + 1
+	start := rand.IntN(n)
+	for i := 0; i < n; i++ {
+		port := strconv.Itoa(dynamicPortMin + (start+i)%n)
+		if h.portUsed(host, port) {
+			continue
+		}
+		h.dynamicPorts[net.JoinHostPort(host, port)] = &dynamicPort{sessionID: sessionID}
+		return port, nil
+	}
+	return "", fmt.Errorf("no port is available for %v", host)
+}
+
+func (h *handler) allocateTCPPort(host, sessionID string) (string, error) {
+	l, d, err := h.listenTCP(host, "0")
+	if err != nil {
+		return "", err
+	}
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		_ = l.Close()
+		return "", err
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	// TCPListenConverter 可能忽略传入的端口
+	if h.portUsed(host, port) {
+		_ = l.Close()
+		return "", fmt.Errorf("allocated port %v for %v is already used: %w", port, host, syscall.EADDRINUSE)
+	}
+	h.dynamicPorts[net.JoinHostPort(host, port)] = &dynamicPort{sessionID: sessionID, l: l, d: d}
+	return port, nil
+}
+
+// portUsed 需要在持有锁时调用
+func (h *handler) portUsed(host, port string) bool {
 	target := net.JoinHostPort(host, port)
+	_, ok := h.proxies[target]
+	return ok || h.dynamicPorts[target] != nil
+}
+
+// allocatedPort 返回 session 在 host 上唯一的动态端口，有多个时无法确定取消的是哪一个
+func (h *handler) allocatedPort(host, sessionID string) (string, bool) {
+	h.Lock()
+	defer h.Unlock()
+	var ret string
+	found := 0
+	for target, r := range h.dynamicPorts {
+		if r.sessionID != sessionID {
+			continue
+		}
+		if rhost, port, err := net.SplitHostPort(target); err == nil && rhost == host {
+			ret = port
+			found++
+		}
+	}
+	return ret, found == 1
+}
+
+func (h *handler) releasePort(host, port, sessionID string) {
+	target := net.JoinHostPort(host, port)
+	h.Lock()
+	defer h.Unlock()
+	r := h.dynamicPorts[target]
+	if r == nil || r.sessionID != sessionID {
+		return
+	}
+	if r.l != nil {
+		_ = r.l.Close()
+	}
+	delete(h.dynamicPorts, target)
+}
+
+func (h *handler) ProxyAlive(host, port string) bool {
+	return h.proxyAlive(net.JoinHostPort(host, port))
+}
+
+func (h *handler) proxyAlive(target string) bool {
 	h.Lock()
 	p, ok := h.proxies[target]
 	h.Unlock()
@@ -202,126 +525,433 @@ func (h *handler) ListProxies() []string {
 	return ret
 }
 
+func (h *handler) ActiveForwards() []ForwardInfo {
+	h.Lock()
+	proxies := make([]*proxy, 0, len(h.proxies))
+	for _, p := range h.proxies {
+		proxies = append(proxies, p)
+	}
+	h.Unlock()
+
+	ret := make([]ForwardInfo, 0)
+	for _, p := range proxies {
+		p.mutex.Lock()
+		for sessionID, ld := range p.lds {
+			ret = append(ret, ForwardInfo{
+				User:        ld.user,
+				SessionID:   sessionID,
+				Host:        p.host,
+				Port:        p.port,
+				BindAddress: ld.bindAddress,
+				Connections: ld.conns.Load(),
+			})
+		}
+		p.mutex.Unlock()
+	}
+	return ret
+}
+
 func (h *handler) AddEventHandler(eh EventHandler) {
 	h.eventHandlers = append(h.eventHandlers, eh)
 }
 
+// HandleSSHRequest 处理 tcpip-forward 和 cancel-tcpip-forward 请求
+// SSH 协议的 request failure 消息不能携带内容，拒绝的原因只能记录在日志和 ForwardDenied 事件中
 func (h *handler) HandleSSHRequest(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
 	authed, _ := ctx.Value(protocol.ContextKeyReverseProxyAuthed).(bool)
 	if !authed {
-		logrus.Infof("User %v is not allowed to handle reverse proxy request.", ctx.User())
+		h.denied(ctx, req, "", &DeniedError{Reason: DenyUnauthenticated, Err: fmt.Errorf("user %v is not authenticated for reverse proxy", ctx.User())})
 		return false, []byte{}
 	}
 
 	conn := ctx.Value(ssh.ContextKeyConn).(*gossh.ServerConn)
 	switch req.Type {
-	case protocol.ForwardRequestType:
-		logrus.Infof("Handle reverse proxy request for user %v", ctx.User())
+	case protocol.ForwardRequestType, protocol.TCPIPForwardRequestType:
+		h.logger.Infof("Handle reverse proxy request for user %v", ctx.User())
 
-		var reqPayload protocol.RemoteForwardRequest
-		if err := gossh.Unmarshal(req.Payload, &reqPayload); err != nil {
-			logrus.Errorf("Failed to parse payload for %v request: %v", req.Type, err)
+		bindAddress, tcpip, err := parseForwardRequest(req)
+		if err != nil {
+			h.denied(ctx, req, "", &DeniedError{Reason: DenyInvalidRequest, Err: fmt.Errorf("parse payload: %w", err)})
 			return false, []byte{}
 		}
 
-		host, port, ok := h.ConvertBindAddressToHostPort(reqPayload.BindUnixSocket)
-		if !ok {
-			logrus.Errorf("User %v request to proxy invalid target %v.", ctx.User(), reqPayload.BindUnixSocket)
+		reply, denied := h.handleForward(ctx, conn, bindAddress, tcpip)
+		if denied != nil {
+			h.denied(ctx, req, bindAddress, denied)
 			return false, []byte{}
 		}
-		if h.authorizer != nil {
-			if !h.authorizer.Authorize(ctx, auth.AuthorizeRequest{
-				User:       ctx.User(),
-				Target:     net.JoinHostPort(host, port),
-				RemoteAddr: ctx.RemoteAddr(),
-				LocalAddr:  ctx.LocalAddr(),
-			}) {
-				logrus.Errorf("User %v request to proxy %v, but it's not allowed.", ctx.User(), reqPayload.BindUnixSocket)
-				return false, []byte{}
-			}
+		return true, reply
+
+	case protocol.CancelRequestType, protocol.CancelTCPIPForwardRequestType:
+		h.logger.Infof("Cancel reverse proxy request for user %v", ctx.User())
+
+		bindAddress, _, err := parseForwardRequest(req)
+		if err != nil {
+			h.logger.Errorf("Failed to parse payload for %v request: %v", req.Type, err)
+			return false, []byte{}
 		}
 
-		l, d := nets.ListenDialerWithBuffer(1024)
-		err := h.addProxy(host, port, ctx.SessionID(), l, d)
+		host, port, err := parseBindAddress(bindAddress)
 		if err != nil {
-			logrus.Errorf("Failed to add proxy for %v(%v:%v): %v", ctx.SessionID(), host, port, err)
+			h.logger.Errorf("User %v request cancel %q, but it's not allowed: %v", ctx.User(), bindAddress, err)
 			return false, []byte{}
 		}
-		go func() {
-			<-ctx.Done()
-			_ = l.Close()
-		}()
-		go func() {
-			for {
-				c, err := l.Accept()
-				if err != nil {
-					logrus.Errorf("Failed to accept connection for %v(%v:%v): %v", ctx.SessionID(), host, port, err)
-					break
-				}
-				go handleConnection(c, conn, reqPayload.BindUnixSocket)
+		if port == "0" {
+			var ok bool
+			port, ok = h.allocatedPort(host, ctx.SessionID())
+			if !ok {
+				h.logger.Errorf("User %v request cancel %v, but it's not found.", ctx.User(), bindAddress)
+				return false, []byte{}
 			}
-			h.removeProxy(host, port, ctx.SessionID())
-		}()
+		}
+		h.removeProxy(host, port, ctx.SessionID(), nil)
 		return true, nil
+	}
 
-	case protocol.CancelRequestType:
-		logrus.Infof("Cancel reverse proxy request for user %v", ctx.User())
+	h.logger.Infof("Unknown request %v from user %v", req.Type, ctx.User())
+	return false, []byte{}
+}
 
-		var reqPayload protocol.RemoteForwardCancelRequest
-		if err := gossh.Unmarshal(req.Payload, &reqPayload); err != nil {
-			logrus.Errorf("Failed to parse payload for %v request: %v", req.Type, err)
-			return false, []byte{}
+// parseForwardRequest 返回请求对应的 /host/port 形式的 bindAddress，
+// 标准的 tcpip-forward 请求同时返回原始的 payload，streamlocal 请求返回 nil
+func parseForwardRequest(req *gossh.Request) (string, *protocol.TCPIPForwardRequest, error) {
+	switch req.Type {
+	case protocol.TCPIPForwardRequestType, protocol.CancelTCPIPForwardRequestType:
+		var payload protocol.TCPIPForwardRequest
+		if err := gossh.Unmarshal(req.Payload, &payload); err != nil {
+			return "", nil, err
+		}
+		host := payload.BindAddr
+		// ssh -R port:host:hostport 未指定监听地址时 BindAddr 为空或 "*"，视为 localhost
+		if host == "" || host == "*" {
+			host = "localhost"
 		}
+		return fmt.Sprintf("/%v/%v", host, payload.BindPort), &payload, nil
+	}
 
-		host, port, ok := h.ConvertBindAddressToHostPort(reqPayload.BindUnixSocket)
-		if !ok {
-			logrus.Errorf("User %v request cancel %v, but it's not allowed.", ctx.User(), reqPayload.BindUnixSocket)
-			return false, []byte{}
+	var payload protocol.RemoteForwardRequest
+	if err := gossh.Unmarshal(req.Payload, &payload); err != nil {
+		return "", nil, err
+	}
+	return payload.BindUnixSocket, nil, nil
+}
+
+func (h *handler) handleForward(ctx ssh.Context, conn *gossh.ServerConn, bindAddress string, tcpip *protocol.TCPIPForwardRequest) ([]byte, *DeniedError) {
+	host, port, err := parseBindAddress(bindAddress)
+	if err != nil {
+		return nil, &DeniedError{Reason: DenyInvalidRequest, Err: err}
+	}
+	dynamic := port == "0"
+	if dynamic {
+		port, err = h.allocatePort(host, ctx.SessionID())
+		if err != nil {
+			return nil, &DeniedError{Reason: DenyUnavailable, Err: fmt.Errorf("allocate port for %v: %w", bindAddress, err)}
+		}
+	}
+	if h.authorizer != nil {
+		if !h.authorizer.Authorize(ctx, authorizeRequest(ctx, ctx.User(), host, port)) {
+			if dynamic {
+				h.releasePort(host, port, ctx.SessionID())
+			}
+			return nil, &DeniedError{Reason: DenyUnauthorized, Err: fmt.Errorf("user %v is not allowed to proxy %v", ctx.User(), bindAddress)}
 		}
-		h.removeProxy(host, port, ctx.SessionID())
-		return true, nil
 	}
 
-	logrus.Infof("Unknown request %v from user %v", req.Type, ctx.User())
-	return false, []byte{}
+	lctx, stop := context.WithCancel(ctx)
+	f := &ld{
+		stop:        stop,
+		user:        ctx.User(),
+		bindAddress: bindAddress,
+	}
+	if tcpip != nil {
+		bindPort, _ := strconv.Atoi(port)
+		f.tcpip = &protocol.TCPIPForwardRequest{BindAddr: tcpip.BindAddr, BindPort: uint32(bindPort)}
+	}
+	err = h.addProxy(host, port, ctx.SessionID(), f)
+	if err != nil {
+		stop()
+		if dynamic {
+			h.releasePort(host, port, ctx.SessionID())
+		}
+		return nil, &DeniedError{Reason: listenDenyReason(err), Err: fmt.Errorf("add proxy %v:%v: %w", host, port, err)}
+	}
+	metrics.FromContext(ctx).ForwardAdded()
+	h.eventsFor(ctx).ForwardRegistered(forwardEvent(ctx, f, host, port))
+	h.serving.Add(1)
+	go h.serveForward(ctx, lctx, conn, f, host, port)
+	if dynamic {
+		bindPort, _ := strconv.Atoi(port)
+		return gossh.Marshal(&protocol.RemoteForwardSuccess{BindPort: uint32(bindPort)}), nil
+	}
+	return nil, nil
 }
 
-func (h *handler) addProxy(host, port, sessionID string, l net.Listener, d nets.NetDialer) error {
+// forwardedChannel 返回将连接转发给客户端时使用的 channel 类型和 payload
+func forwardedChannel(c net.Conn, f *ld) (string, []byte) {
+	if f.tcpip == nil {
+		return protocol.ForwardedRequestType, gossh.Marshal(&protocol.RemoteForwardChannelData{
+			SocketPath: f.bindAddress,
+			Reserved:   "",
+		})
+	}
+	data := protocol.ForwardedTCPIPChannelData{
+		Addr: f.tcpip.BindAddr,
+		Port: f.tcpip.BindPort,
+	}
+	if host, port, err := net.SplitHostPort(c.RemoteAddr().String()); err == nil {
+		originPort, _ := strconv.Atoi(port)
+		data.OriginAddr, data.OriginPort = host, uint32(originPort)
+	}
+	return protocol.ForwardedTCPIPChannelType, gossh.Marshal(&data)
+}
+
+func (h *handler) denied(ctx ssh.Context, req *gossh.Request, bindAddress string, err *DeniedError) {
+	logger.WithField(h.logger, "reason", err.Reason).Errorf("Denied %v request %v from user %v in %v: %v", req.Type, bindAddress, ctx.User(), ctx.SessionID(), err.Err)
+	h.eventsFor(ctx).ForwardDenied(events.ForwardEvent{
+		User:        ctx.User(),
+		SessionID:   ctx.SessionID(),
+		BindAddress: bindAddress,
+		Reason:      string(err.Reason),
+	})
+}
+
+// addProxy 在同一把锁内完成重复检查、监听和注册，避免并发请求同一个 target 时出现竞争
+func (h *handler) addProxy(host, port, sessionID string, f *ld) error {
 	target := net.JoinHostPort(host, port)
 	h.Lock()
 	defer h.Unlock()
+	if h.closed {
+		return fmt.Errorf("reverse proxy is closed")
+	}
+	if h.maxForwardsPerUser > 0 && h.userForwards[f.user] >= h.maxForwardsPerUser {
+		return fmt.Errorf("user %v already has %v forwards", f.user, h.userForwards[f.user])
+	}
+
 	p, ok := h.proxies[target]
+	if ok {
+		for ownerSessionID, owner := range p.owners() {
+			if h.replaceExistingForward {
+				if removed, _ := p.removeLD(ownerSessionID, owner); removed != nil {
+					h.releaseUserForward(removed.user)
+				}
+				h.logger.Warnf("Forward %v of user %v in %v is replaced by user %v in %v", target, owner.user, ownerSessionID, f.user, sessionID)
+				continue
+			}
+			// 内存模式下允许多个隧道在服务内部负载均衡，其他模式下同一个地址只能被监听一次
+			if h.listenMode != ListenModeMemory {
+				return fmt.Errorf("forward %v is already owned by user %v in %v: %w", target, owner.user, ownerSessionID, syscall.EADDRINUSE)
+			}
+		}
+	}
+
+	var l net.Listener
+	var d nets.NetDialer
+	if r := h.dynamicPorts[target]; r != nil {
+		if r.sessionID != sessionID {
+			return fmt.Errorf("port %v is allocated to %v: %w", port, r.sessionID, syscall.EADDRINUSE)
+		}
+		l, d = r.l, r.d
+		r.l, r.d = nil, nil
+	}
+	if l == nil {
+		var err error
+		l, d, err = h.listen(host, port)
+		if err != nil {
+			return err
+		}
+	}
+	f.l, f.d = l, d
+
 	if !ok {
 		p = &proxy{
 			host: host,
 			port: port,
-			lds:  make(map[string]ld),
+			lds:  make(map[string]*ld),
 		}
 		h.proxies[target] = p
+		h.notifyRegistry()
 		h.eventHandlers.OnAdd(host, port)
 	}
-	if err := p.addLD(sessionID, l, d); err != nil {
+	if err := p.addLD(sessionID, f); err != nil {
+		_ = l.Close()
 		return err
 	}
-	logrus.Infof("Forward request in %v %v is ready", sessionID, target)
+	h.userForwards[f.user]++
+	h.logger.Infof("Forward request in %v %v is ready", sessionID, target)
 	return nil
 }
 
-func (h *handler) removeProxy(host, port, sessionID string) {
+func (h *handler) releaseUserForward(user string) {
+	h.userForwards[user]--
+	if h.userForwards[user] <= 0 {
+		delete(h.userForwards, user)
+	}
+}
+
+func (h *handler) serveForward(ctx ssh.Context, lctx context.Context, conn *gossh.ServerConn, f *ld, host, port string) {
+	defer h.serving.Done()
+	defer f.stop()
+	target := f.bindAddress
+	var inflight sync.WaitGroup
+	abort := make(chan struct{})
+	if h.authorizer != nil && h.revocationCheckInterval > 0 {
+		go h.watchRevocation(ctx, lctx, f, host, port)
+	}
+	err := nets.HandleListenerContext(lctx, f.l, func(c net.Conn) {
+		if !h.authorizeConnection(ctx, f, host, port) {
+			h.logger.Warnf("Connection to %v in %v is refused, user %v is no longer allowed", target, ctx.SessionID(), f.user)
+			_ = c.Close()
+			return
+		}
+		f.conns.Add(1)
+		defer f.conns.Add(-1)
+		h.handleConnection(ctx, c, conn, f, abort)
+	}, nets.WithTracker(&inflight), nets.WithConcurrencyLimit(h.maxConnectionsPerForward),
+		nets.WithAcceptRetryHandler(func(err error, delay time.Duration) {
+			h.logger.Warnf("Failed to accept connection for %v(%v:%v), retrying in %v: %v", ctx.SessionID(), host, port, delay, err)
+		}))
+	if err != nil {
+		h.logger.Errorf("Failed to accept connection for %v(%v:%v): %v", ctx.SessionID(), host, port, err)
+	}
+	h.removeProxy(host, port, ctx.SessionID(), f)
+	h.releasePort(host, port, ctx.SessionID())
+	metrics.FromContext(ctx).ForwardRemoved()
+	h.eventsFor(ctx).ForwardCanceled(forwardEvent(ctx, f, host, port))
+
+	drained := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(drained)
+	}()
+	if h.drainTimeout <= 0 {
+		<-drained
+		return
+	}
+	select {
+	case <-drained:
+	case <-h.clock.After(h.drainTimeout):
+		h.logger.Warnf("Forward %v in %v is not drained in %v, force closing", target, ctx.SessionID(), h.drainTimeout)
+		close(abort)
+		<-drained
+	}
+}
+
+// Waiter 由 NewWithOptions 返回的 Handler 实现，Wait 等待所有转发的清理完成，通常在连接全部关闭后调用
+type Waiter interface {
+	Wait(ctx context.Context) error
+}
+
+func (h *handler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.serving.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// authorizeConnection 在开启 WithConnectionAuthorization 时对每个连接重新授权，结果缓存 connectionAuthTTL
+func (h *handler) authorizeConnection(ctx ssh.Context, f *ld, host, port string) bool {
+	if h.authorizer == nil || h.connectionAuthTTL <= 0 {
+		return true
+	}
+	f.authMutex.Lock()
+	defer f.authMutex.Unlock()
+	if !f.authAt.IsZero() && h.clock.Now().Sub(f.authAt) < h.connectionAuthTTL {
+		return f.authAllowed
+	}
+	f.authAllowed = h.authorizer.Authorize(ctx, authorizeRequest(ctx, f.user, host, port))
+	f.authAt = h.clock.Now()
+	return f.authAllowed
+}
+
+// watchRevocation 每隔 revocationCheckInterval 重新授权一次，用户不再被允许时关闭转发的监听
+func (h *handler) watchRevocation(ctx ssh.Context, lctx context.Context, f *ld, host, port string) {
+	t := h.clock.NewTicker(h.revocationCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-lctx.Done():
+			return
+		case <-t.C():
+		}
+		if !h.authorizer.Authorize(ctx, authorizeRequest(ctx, f.user, host, port)) {
+			h.logger.Warnf("Forward %v of user %v in %v is revoked, closing", f.bindAddress, f.user, ctx.SessionID())
+			f.stop()
+			return
+		}
+	}
+}
+
+func authorizeRequest(ctx ssh.Context, user, host, port string) auth.AuthorizeRequest {
+	return auth.AuthorizeRequest{
+		User:       user,
+		Target:     net.JoinHostPort(host, port),
+		RemoteAddr: ctx.RemoteAddr(),
+		LocalAddr:  ctx.LocalAddr(),
+		Identity:   auth.IdentityFromContext(ctx),
+	}
+}
+
+func (h *handler) removeProxy(host, port, sessionID string, f *ld) {
 	target := net.JoinHostPort(host, port)
 	h.Lock()
 	defer h.Unlock()
 	p, ok := h.proxies[target]
 	if ok {
-		if p.removeLD(sessionID) {
+		removed, empty := p.removeLD(sessionID, f)
+		if removed != nil {
+			h.releaseUserForward(removed.user)
+		}
+		if empty {
 			delete(h.proxies, target)
+			h.notifyRegistry()
 			h.eventHandlers.OnRemove(host, port)
 		}
 	}
-	logrus.Infof("Forward request in %v %v is canceled", sessionID, target)
+	h.logger.Infof("Forward request in %v %v is canceled", sessionID, target)
+}
+
+// Close 实现 io.Closer，关闭所有转发的监听并拒绝新的转发，未设置 WithUnixDirectory 时同时删除自动创建的临时目录
+func (h *handler) Close() error {
+	h.Lock()
+	if h.closed {
+		h.Unlock()
+		return nil
+	}
+	h.closed = true
+	proxies := make([]*proxy, 0, len(h.proxies))
+	for _, p := range h.proxies {
+		proxies = append(proxies, p)
+	}
+	h.Unlock()
+
+	for _, p := range proxies {
+		for sessionID, f := range p.owners() {
+			h.removeProxy(p.host, p.port, sessionID, f)
+		}
+	}
+	if h.registry != nil {
+		close(h.registryDone)
+		<-h.registryStopped
+	}
+	if h.tempDirectory {
+		return os.RemoveAll(h.unixDirectory)
+	}
+	return nil
 }
 
 func (h *handler) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if host, ok := normalizeHost(host); ok {
+			addr = net.JoinHostPort(host, port)
+		}
+	}
 	h.Lock()
 	p, ok := h.proxies[addr]
 	h.Unlock()
@@ -331,26 +961,106 @@ func (h *handler) DialContext(ctx context.Context, network, addr string) (net.Co
 	return p.DialContext(ctx, network, addr)
 }
 
-func handleConnection(c net.Conn, conn *gossh.ServerConn, target string) {
-	payload := gossh.Marshal(&protocol.RemoteForwardChannelData{
-		SocketPath: target,
-		Reserved:   "",
-	})
-	ch, reqs, err := conn.OpenChannel(protocol.ForwardedRequestType, payload)
+func (h *handler) handleConnection(ctx ssh.Context, c net.Conn, conn *gossh.ServerConn, f *ld, abort <-chan struct{}) {
+	target := f.bindAddress
+	channelType, payload := forwardedChannel(c, f)
+	ch, reqs, err := conn.OpenChannel(channelType, payload)
 	if err != nil {
-		logrus.Errorf("Failed to open channel for %v: %v", target, err)
+		h.logger.Errorf("Failed to open channel for %v: %v", target, err)
 		c.Close()
 		return
 	}
 	go gossh.DiscardRequests(reqs)
+
+	event := events.ConnectionEvent{
+		User:       ctx.User(),
+		SessionID:  ctx.SessionID(),
+		Path:       "reverseproxy",
+		Target:     target,
+		RemoteAddr: c.RemoteAddr(),
+	}
+	h.eventsFor(ctx).ConnectionOpened(event)
+
+	cc := nets.NewCountingConn(c)
+	defer func() {
+		rx, tx := cc.Transferred()
+		metrics.FromContext(ctx).Transferred("reverseproxy", tx, rx)
+		event.In, event.Out = tx, rx
+		h.eventsFor(ctx).ConnectionClosed(event)
+		if h.onTransfer != nil {
+			h.onTransfer(ctx.SessionID()+"/"+target, rx, tx)
+		}
+	}()
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			_ = ch.Close()
+			_ = c.Close()
+		})
+	}
+
+	var rw io.ReadWriter = cc
+	if h.idleTimeout > 0 {
+		// 从 c 读到数据说明被转发的连接一端活跃，写入 c 说明 ssh channel 一端活跃
+		ic := nets.NewIdleConnWithClock(cc, h.clock, h.idleTimeout, func(connIdle, channelIdle time.Duration) {
+			side := "connection"
+			if channelIdle > connIdle {
+				side = "channel"
+			}
+			h.logger.Infof("Connection %v in %v is idle for %v (%v side idle longest), closing",
+				target, ctx.SessionID(), h.idleTimeout, side)
+			cleanup()
+		})
+		defer ic.Stop()
+		rw = ic
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer cleanup()
+		_ = nets.IOCopyBuffer(ch, rw, h.copyBufferSize)
+	}()
 	go func() {
-		defer ch.Close()
-		defer c.Close()
-		_ = nets.IOCopy(ch, c)
+		defer wg.Done()
+		defer cleanup()
+		_ = nets.IOCopyBuffer(rw, ch, h.copyBufferSize)
 	}()
+
+	done := make(chan struct{})
 	go func() {
-		defer ch.Close()
-		defer c.Close()
-		_ = nets.IOCopy(c, ch)
+		wg.Wait()
+		close(done)
 	}()
+	// SSH 连接断开时立即关闭被转发的连接，不需要等待下一次读写失败；
+	// 仅取消转发时已有连接继续运行，直到 drainTimeout 后 abort
+	select {
+	case <-done:
+	case <-abort:
+		cleanup()
+		<-done
+	case <-ctx.Done():
+		cleanup()
+		<-done
+	}
+}
+
+// eventsFor 优先使用 WithEvents 设置的事件处理，否则使用服务器写入 context 的
+func (h *handler) eventsFor(ctx context.Context) events.Events {
+	if h.events != nil {
+		return h.events
+	}
+	return events.FromContext(ctx)
+}
+
+func forwardEvent(ctx ssh.Context, f *ld, host, port string) events.ForwardEvent {
+	return events.ForwardEvent{
+		User:        f.user,
+		SessionID:   ctx.SessionID(),
+		Host:        host,
+		Port:        port,
+		BindAddress: f.bindAddress,
+	}
 }
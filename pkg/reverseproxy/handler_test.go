@@ -0,0 +1,233 @@
+package reverseproxy
+
+import (
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestHandler(t *testing.T, options ...Option) *handler {
+	t.Helper()
+	h, err := NewWithOptions(append([]Option{WithUnixDirectory(t.TempDir())}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.(*handler).Close() })
+	return h.(*handler)
+}
+
+func TestAllocatePortIsReserved(t *testing.T) {
+	h := newTestHandler(t)
+
+	var mutex sync.Mutex
+	ports := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			port, err := h.allocatePort("localhost", "s"+strconv.Itoa(i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if ports[port] {
+				t.Errorf("port %v is allocated twice", port)
+			}
+			ports[port] = true
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAllocatedPortInSameSession(t *testing.T) {
+	h := newTestHandler(t)
+
+	first, err := h.allocatePort("localhost", "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, ok := h.allocatedPort("localhost", "s"); !ok || port != first {
+		t.Fatalf("allocatedPort = %v, %v, want %v", port, ok, first)
+	}
+
+	second, err := h.allocatePort("localhost", "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一个 session 有两个动态端口时，只能按分配的端口取消
+	if _, ok := h.allocatedPort("localhost", "s"); ok {
+		t.Fatal("allocatedPort should be ambiguous with two dynamic ports")
+	}
+	if err := h.addProxy("localhost", first, "other", &ld{user: "u"}); err == nil {
+		t.Fatal("another session should not use an allocated port")
+	}
+	if err := h.addProxy("localhost", first, "s", &ld{user: "u"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.releasePort("localhost", second, "s")
+	if port, ok := h.allocatedPort("localhost", "s"); !ok || port != first {
+		t.Fatalf("allocatedPort = %v, %v, want %v", port, ok, first)
+	}
+}
+
+func TestAllocateTCPPort(t *testing.T) {
+	h := newTestHandler(t, WithListenMode(ListenModeTCP), WithTCPListenConverter(func(host, port string) (string, bool) {
+		return net.JoinHostPort("127.0.0.1", port), true
+	}))
+
+	port, err := h.allocatePort("localhost", "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port == "0" {
+		t.Fatal("port is not read back from the listener")
+	}
+	f := &ld{user: "u"}
+	if err := h.addProxy("localhost", port, "s", f); err != nil {
+		t.Fatal(err)
+	}
+	if _, got, _ := net.SplitHostPort(f.l.Addr().String()); got != port {
+		t.Fatalf("listener port = %v, want %v", got, port)
+	}
+	c, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+}
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+		ok   bool
+	}{
+		{"::1", "::1", true},
+		{"[::1]", "::1", true},
+		{"[0:0:0:0:0:0:0:1]", "::1", true},
+		{"fe80::1%eth0", "fe80::1%eth0", true},
+		{"[fe80::1%eth0]", "fe80::1%eth0", true},
+		{"127.0.0.1", "127.0.0.1", true},
+		{"[127.0.0.1]", "127.0.0.1", true},
+		{"www.example.com", "www.example.com", true},
+		{"[www.example.com]", "www.example.com", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeHost(tt.host)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("normalizeHost(%q) = %q, %v, want %q, %v", tt.host, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseBindAddress(t *testing.T) {
+	tests := []struct {
+		bindAddress string
+		host        string
+		port        string
+		wantErr     bool
+	}{
+		{"/web/80", "web", "80", false},
+		{"web/80", "web", "80", false},
+		{"/[::1]/22", "::1", "22", false},
+		{"/127.0.0.1/0", "127.0.0.1", "0", false},
+		{"/web/65535", "web", "65535", false},
+		{"/web", "", "", true},
+		{"/web/", "", "", true},
+		{"/web/65536", "", "", true},
+		{"/web/-1", "", "", true},
+		{"/web/+80", "", "", true},
+		{"/web/080", "", "", true},
+		{"/web/80/x", "", "", true},
+		{"//80", "", "", true},
+		{"/[web]/80", "", "", true},
+		{"/" + strings.Repeat("a", 254) + "/80", "", "", true},
+		{"/a\x7fb/80", "", "", true},
+		{"/a\tb/80", "", "", true},
+	}
+	for _, tt := range tests {
+		host, port, err := parseBindAddress(tt.bindAddress)
+		if (err != nil) != tt.wantErr || host != tt.host || port != tt.port {
+			t.Errorf("parseBindAddress(%q) = %q, %q, %v, want %q, %q", tt.bindAddress, host, port, err, tt.host, tt.port)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{"web", false},
+		{"www.example.com", false},
+		{"fe80::1%eth0", false},
+		{strings.Repeat("a", 253), false},
+		{"", true},
+		{strings.Repeat("a", 254), true},
+		{"..", true},
+		{"a..b", true},
+		{"a/b", true},
+		{"a\\b", true},
+		{"a\x00b", true},
+		{"a\nb", true},
+	}
+	for _, tt := range tests {
+		if err := checkHost(tt.host); (err != nil) != tt.wantErr {
+			t.Errorf("checkHost(%q) = %v, wantErr %v", tt.host, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBindAddressPathTraversal(t *testing.T) {
+	h := newTestHandler(t)
+	for _, bindAddress := range []string{
+		"/../../etc/80",
+		"/..\\..\\etc/80",
+		"/../80",
+		"/a..b/80",
+		"/etc.sock\x00/80",
+		"/[..]/80",
+	} {
+		if host, port, ok := h.ConvertBindAddressToHostPort(bindAddress); ok {
+			t.Errorf("bind address %q is accepted as %v:%v", bindAddress, host, port)
+		}
+	}
+}
+
+func TestCloseRemovesTempDirectory(t *testing.T) {
+	rp, err := NewWithOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := rp.(*handler)
+	if _, err := os.Stat(h.unixDirectory); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(h.unixDirectory); !os.IsNotExist(err) {
+		t.Fatalf("temp directory %v still exists: %v", h.unixDirectory, err)
+	}
+
+	// WithUnixDirectory 指定的目录由调用方管理，不删除
+	dir := t.TempDir()
+	rp, err = NewWithOptions(WithUnixDirectory(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("directory %v should be kept: %v", dir, err)
+	}
+}
@@ -0,0 +1,141 @@
+package reverseproxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pigeonligh/srp/pkg/nets"
+)
+
+type ListenMode int
+
+const (
+	// ListenModeMemory 转发只能通过 Handler.DialContext 访问
+	ListenModeMemory ListenMode = iota
+	// ListenModeTCP 转发同时监听在真实的 TCP 地址上，可以从网络中直接访问
+	ListenModeTCP
+	// ListenModeUnix 转发同时监听在 unixDirectory 下的 unix socket 上
+	ListenModeUnix
+)
+
+type TCPListenConverter func(host, port string) (string, bool)
+
+func DefaultTCPListenConverter(host, port string) (string, bool) {
+	return net.JoinHostPort("0.0.0.0", port), true
+}
+
+func (h *handler) ConvertHostPortToTCPListen(host, port string) (string, bool) {
+	if h.tcpListenConverter == nil {
+		return DefaultTCPListenConverter(host, port)
+	}
+	return h.tcpListenConverter(host, port)
+}
+
+// maxSocketPathLength 为 unix socket 路径的最大长度，Linux 上 sun_path 为 108 字节且需要以 \0 结尾
+const maxSocketPathLength = 107
+
+// ConvertHostPortToSocket 在端口为数字且路径不超长时使用 host_port.sock，
+// 否则使用 h-<sha256(host:port)>.sock，两种文件名不会相互冲突
+func (h *handler) ConvertHostPortToSocket(host, port string) (string, bool) {
+	socket := filepath.Join(h.unixDirectory, host+"_"+port+".sock")
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil || len(socket) > maxSocketPathLength {
+		h.logger.Debugf("Use hashed socket name for %v", net.JoinHostPort(host, port))
+		socket = filepath.Join(h.unixDirectory, hashedSocketName(host, port))
+	}
+	if len(socket) > maxSocketPathLength {
+		return "", false
+	}
+	// socket 必须直接位于 unixDirectory 中
+	if filepath.Dir(socket) != filepath.Clean(h.unixDirectory) {
+		return "", false
+	}
+	return socket, true
+}
+
+func hashedSocketName(host, port string) string {
+	sum := sha256.Sum256([]byte(net.JoinHostPort(host, port)))
+	return "h-" + hex.EncodeToString(sum[:16]) + ".sock"
+}
+
+// checkSocketDirectory 保证 unixDirectory 中至少可以放下哈希后的 socket 文件名，
+// writable 时同时检查目录可写，避免启动后每个转发请求才失败
+func checkSocketDirectory(dir string, writable bool) error {
+	socket := filepath.Join(dir, hashedSocketName("", ""))
+	if len(socket) > maxSocketPathLength {
+		return fmt.Errorf("unix directory %v is too long for socket paths (%v > %v bytes)", dir, len(socket), maxSocketPathLength)
+	}
+	if !writable {
+		return nil
+	}
+	f, err := os.CreateTemp(dir, ".srp-check-*")
+	if err != nil {
+		return fmt.Errorf("unix directory %v is not writable: %w", dir, err)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+func (h *handler) SocketAlive(socket string) bool {
+	stat, _ := os.Stat(socket)
+	return stat != nil && stat.Mode()&os.ModeSocket != 0
+}
+
+func (h *handler) listen(host, port string) (net.Listener, nets.NetDialer, error) {
+	switch h.listenMode {
+	case ListenModeTCP:
+		return h.listenTCP(host, port)
+	case ListenModeUnix:
+		return h.listenUnix(host, port)
+	}
+	l, d := nets.ListenDialerWithBuffer(1024)
+	return l, d, nil
+}
+
+func (h *handler) listenUnix(host, port string) (net.Listener, nets.NetDialer, error) {
+	socket, ok := h.ConvertHostPortToSocket(host, port)
+	if !ok {
+		return nil, nil, fmt.Errorf("no unix socket for %v", net.JoinHostPort(host, port))
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 在开始 Accept 之前修改权限，避免其他本地用户利用默认权限接入
+	if h.socketFileMode != 0 {
+		if err := os.Chmod(socket, h.socketFileMode); err != nil {
+			_ = l.Close()
+			return nil, nil, fmt.Errorf("chmod socket: %w", err)
+		}
+	}
+	if h.socketOwnerUID >= 0 || h.socketOwnerGID >= 0 {
+		if err := os.Chown(socket, h.socketOwnerUID, h.socketOwnerGID); err != nil {
+			_ = l.Close()
+			return nil, nil, fmt.Errorf("chown socket: %w", err)
+		}
+	}
+	d := nets.NetDialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nets.DefaultNetDialer.DialContext(ctx, "unix", socket)
+	})
+	return l, d, nil
+}
+
+func (h *handler) listenTCP(host, port string) (net.Listener, nets.NetDialer, error) {
+	address, ok := h.ConvertHostPortToTCPListen(host, port)
+	if !ok {
+		return nil, nil, fmt.Errorf("no tcp listen address for %v", net.JoinHostPort(host, port))
+	}
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, nil, err
+	}
+	d := nets.NetDialerFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nets.DefaultNetDialer.DialContext(ctx, "tcp", l.Addr().String())
+	})
+	return l, d, nil
+}
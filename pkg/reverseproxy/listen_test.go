@@ -0,0 +1,42 @@
+package reverseproxy
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertHostPortToSocketLongDirectory(t *testing.T) {
+	// 目录本身可以放下哈希后的文件名，但放不下较长的 host_port.sock
+	base := t.TempDir()
+	pad := maxSocketPathLength - len("/"+hashedSocketName("", "")) - len(base) - 1
+	if pad <= 0 {
+		t.Skipf("temp directory %v is too long", base)
+	}
+	dir := filepath.Join(base, strings.Repeat("d", pad))
+	h := newTestHandler(t, WithUnixDirectory(dir))
+
+	host := strings.Repeat("h", 40) + ".example.com"
+	socket, ok := h.ConvertHostPortToSocket(host, "80")
+	if !ok {
+		t.Fatal("socket should fall back to a hashed name")
+	}
+	if len(socket) > maxSocketPathLength {
+		t.Fatalf("socket %v is longer than %v bytes", socket, maxSocketPathLength)
+	}
+	if filepath.Dir(socket) != dir || !strings.HasPrefix(filepath.Base(socket), "h-") {
+		t.Fatalf("socket = %v, want a hashed name in %v", socket, dir)
+	}
+
+	short, ok := h.ConvertHostPortToSocket("a", "80")
+	if !ok || filepath.Base(short) != "a_80.sock" {
+		t.Fatalf("socket = %v, %v, want a_80.sock", short, ok)
+	}
+}
+
+func TestNewWithOverLongDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), strings.Repeat("d", maxSocketPathLength))
+	if _, err := NewWithOptions(WithUnixDirectory(dir)); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Fatalf("NewWithOptions = %v, want too long error", err)
+	}
+}
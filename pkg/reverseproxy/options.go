@@ -0,0 +1,180 @@
+package reverseproxy
+
+import (
+	"os"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/auth"
+	"github.com/pigeonligh/srp/pkg/clock"
+	"github.com/pigeonligh/srp/pkg/events"
+	"github.com/pigeonligh/srp/pkg/logger"
+	"github.com/pigeonligh/srp/pkg/nets"
+)
+
+type Option func(*handler)
+
+func WithLogger(l logger.Logger) Option {
+	return func(h *handler) {
+		h.logger = l
+	}
+}
+
+func WithAuthenticator(authenticator auth.Authenticator) Option {
+	return func(h *handler) {
+		h.authenticator = authenticator
+	}
+}
+
+// WithKeyboardInteractiveAuthenticator 设置 keyboard-interactive 认证，可用于 MFA 等需要多次提示的场景
+func WithKeyboardInteractiveAuthenticator(authenticator auth.KeyboardInteractiveAuthenticator) Option {
+	return func(h *handler) {
+		h.kiAuthenticator = authenticator
+	}
+}
+
+// WithAuthMethods 只启用 methods 中的认证方式（auth.MethodPassword 等），未启用的方式不会提供给客户端，
+// 未设置时启用所有方式，只影响本 Handler，同时设置了 proxy.Handler 时使用 server.WithAuthMethods
+func WithAuthMethods(methods ...string) Option {
+	return func(h *handler) {
+		h.authMethods = make(map[string]bool, len(methods))
+		for _, m := range methods {
+			h.authMethods[m] = true
+		}
+	}
+}
+
+func WithAuthorizer(authorizer auth.Authorizer) Option {
+	return func(h *handler) {
+		h.authorizer = authorizer
+	}
+}
+
+// WithConnectionAuthorization 在转发注册后对每个新连接重新调用 Authorizer，
+// 用于授权规则会在运行时变化的场景，结果缓存 ttl 以减少对 Authorizer 的调用
+func WithConnectionAuthorization(ttl time.Duration) Option {
+	return func(h *handler) {
+		h.connectionAuthTTL = ttl
+	}
+}
+
+// WithRevocationCheckInterval 定期对已注册的转发重新调用 Authorizer，不再被允许的转发会被关闭，
+// 已有连接按 WithDrainTimeout 处理，为 0 时不检查
+func WithRevocationCheckInterval(interval time.Duration) Option {
+	return func(h *handler) {
+		h.revocationCheckInterval = interval
+	}
+}
+
+// WithClock 设置 drain 超时、空闲超时、连接授权缓存和撤销检查使用的时钟，测试中可以使用 clocktest.Fake
+func WithClock(c clock.Clock) Option {
+	return func(h *handler) {
+		h.clock = clock.Or(c)
+	}
+}
+
+func WithUnixDirectory(dir string) Option {
+	return func(h *handler) {
+		h.unixDirectory = dir
+	}
+}
+
+// WithDrainTimeout 设置转发被取消后等待已有连接结束的最长时间，超时后强制关闭，为 0 时一直等待
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(h *handler) {
+		h.drainTimeout = timeout
+	}
+}
+
+// WithIdleTimeout 设置转发连接的空闲超时，两端在该时间内都没有数据时关闭连接，为 0 时不检测
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(h *handler) {
+		h.idleTimeout = timeout
+	}
+}
+
+// WithCopyBufferSize 设置转发连接时每个方向的缓冲区大小，为 0 时使用 nets.DefaultCopyBufferSize
+func WithCopyBufferSize(size int) Option {
+	return func(h *handler) {
+		h.copyBufferSize = size
+	}
+}
+
+// WithStaleSocketCleanup 控制启动时是否清理 unix socket 目录中残留的失效 socket，默认开启
+func WithStaleSocketCleanup(enabled bool) Option {
+	return func(h *handler) {
+		h.cleanupStaleSockets = enabled
+	}
+}
+
+// WithMaxForwardsPerUser 限制每个用户同时存在的转发数量，为 0 时不限制
+func WithMaxForwardsPerUser(n int) Option {
+	return func(h *handler) {
+		h.maxForwardsPerUser = n
+	}
+}
+
+func WithListenMode(mode ListenMode) Option {
+	return func(h *handler) {
+		h.listenMode = mode
+	}
+}
+
+// WithTCPListenConverter 设置 ListenModeTCP 下转发所监听的 TCP 地址
+func WithTCPListenConverter(converter TCPListenConverter) Option {
+	return func(h *handler) {
+		h.tcpListenConverter = converter
+	}
+}
+
+// WithSocketFileMode 设置 ListenModeUnix 下 socket 文件的权限，为 0 时保持默认
+func WithSocketFileMode(mode os.FileMode) Option {
+	return func(h *handler) {
+		h.socketFileMode = mode
+	}
+}
+
+// WithSocketOwner 设置 ListenModeUnix 下 socket 文件的属主，为 -1 时保持默认
+func WithSocketOwner(uid, gid int) Option {
+	return func(h *handler) {
+		h.socketOwnerUID = uid
+		h.socketOwnerGID = gid
+	}
+}
+
+// WithReplaceExistingForward 开启后，新的转发请求会关闭并替换同一 target 上已有的转发
+func WithReplaceExistingForward(enabled bool) Option {
+	return func(h *handler) {
+		h.replaceExistingForward = enabled
+	}
+}
+
+// WithTransferFunc 设置流量上报回调，在每个转发连接关闭时调用，id 为 sessionID/bindAddress
+func WithTransferFunc(f nets.TransferFunc) Option {
+	return func(h *handler) {
+		h.onTransfer = f
+	}
+}
+
+// WithMaxConnectionsPerForward 限制每个转发同时处理的连接数，达到上限时暂停 accept，为 0 时不限制
+func WithMaxConnectionsPerForward(limit int) Option {
+	return func(h *handler) {
+		h.maxConnectionsPerForward = limit
+	}
+}
+
+// WithEvents 设置转发与连接事件的处理，事件在单独的 goroutine 中处理
+func WithEvents(e events.Events) Option {
+	return func(h *handler) {
+		h.events = events.Async(e)
+	}
+}
+
+// WithForwardRegistry 在后台把本地的 target 与 instance 登记到 registry，租期为 ttl，为 0 时使用 DefaultForwardRegistryTTL，不能小于 MinForwardRegistryTTL，
+// 多副本部署时各副本使用不同的 instance 和同一个共享的 registry
+func WithForwardRegistry(registry ForwardRegistry, instance string, ttl time.Duration) Option {
+	return func(h *handler) {
+		h.registry = registry
+		h.instance = instance
+		h.registryTTL = ttl
+	}
+}
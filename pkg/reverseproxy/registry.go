@@ -0,0 +1,178 @@
+package reverseproxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/clock"
+)
+
+var (
+	// DefaultForwardRegistryTimeout 为每次调用 ForwardRegistry 的最长时间
+	DefaultForwardRegistryTimeout = 3 * time.Second
+	// DefaultForwardRegistryTTL 为登记的租期，Handler 每隔三分之一租期续约一次，实例异常退出后记录最多保留一个租期
+	DefaultForwardRegistryTTL = 30 * time.Second
+)
+
+// MinForwardRegistryTTL 为 WithForwardRegistry 允许的最短租期
+const MinForwardRegistryTTL = time.Second
+
+// ForwardRegistry 记录每个 target 由哪个实例提供，多副本部署时可以基于 Redis、etcd 等共享存储实现，
+// 让其他副本通过 ForwardLocator 得知转发所在的实例
+//
+// Register 登记或续约 target，超过 ttl 没有续约的记录视为过期，Lookup 不再返回。
+// Handler 在后台 goroutine 中调用，不持有锁，失败只记录日志，在下一次续约时重试
+type ForwardRegistry interface {
+	Register(ctx context.Context, target, instance string, ttl time.Duration) error
+	Unregister(ctx context.Context, target, instance string) error
+	Lookup(ctx context.Context, target string) (instance string, ok bool, err error)
+}
+
+// ForwardLocator 由 NewWithOptions 返回的 Handler 实现，返回提供 target（host:port）的实例，
+// 本地存在转发时直接返回 WithForwardRegistry 设置的实例名，否则查询 ForwardRegistry，未设置时只检查本地
+type ForwardLocator interface {
+	LookupForward(ctx context.Context, target string) (instance string, ok bool, err error)
+}
+
+type localForward struct {
+	instance string
+	expires  time.Time
+}
+
+type localForwardRegistry struct {
+	clock    clock.Clock
+	mutex    sync.RWMutex
+	forwards map[string]localForward // host:port => instance
+}
+
+// NewLocalForwardRegistry 返回保存在内存中的 ForwardRegistry，只在当前进程内共享
+func NewLocalForwardRegistry() ForwardRegistry {
+	return &localForwardRegistry{
+		clock:    clock.Real,
+		forwards: make(map[string]localForward),
+	}
+}
+
+func (r *localForwardRegistry) Register(_ context.Context, target, instance string, ttl time.Duration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.forwards[target] = localForward{instance: instance, expires: r.clock.Now().Add(ttl)}
+	return nil
+}
+
+func (r *localForwardRegistry) Unregister(_ context.Context, target, instance string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.forwards[target].instance == instance {
+		delete(r.forwards, target)
+	}
+	return nil
+}
+
+func (r *localForwardRegistry) Lookup(_ context.Context, target string) (string, bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	f, ok := r.forwards[target]
+	if !ok || !r.clock.Now().Before(f.expires) {
+		return "", false, nil
+	}
+	return f.instance, true, nil
+}
+
+// notifyRegistry 通知后台 goroutine 本地的转发发生了变化，可以在持有锁时调用
+func (h *handler) notifyRegistry() {
+	if h.registry == nil {
+		return
+	}
+	select {
+	case h.registryNotify <- struct{}{}:
+	default:
+	}
+}
+
+// runRegistry 把本地的转发同步到 ForwardRegistry，转发变化时立即同步，每隔三分之一租期续约所有转发，
+// Close 后注销所有登记的转发
+func (h *handler) runRegistry() {
+	defer close(h.registryStopped)
+	t := h.clock.NewTicker(h.registryTTL / 3)
+	defer t.Stop()
+
+	registered := make(map[string]bool) // 登记失败的为 false，下次同步时重试
+	for {
+		renew := false
+		select {
+		case <-h.registryNotify:
+		case <-t.C():
+			renew = true
+		case <-h.registryDone:
+			for target := range registered {
+				h.unregisterForward(target)
+			}
+			return
+		}
+
+		targets := h.localTargets()
+		for target := range targets {
+			if renew || !registered[target] {
+				registered[target] = h.registerForward(target)
+			}
+		}
+		for target := range registered {
+			if !targets[target] && h.unregisterForward(target) {
+				delete(registered, target)
+			}
+		}
+	}
+}
+
+func (h *handler) localTargets() map[string]bool {
+	h.Lock()
+	defer h.Unlock()
+	targets := make(map[string]bool, len(h.proxies))
+	for target := range h.proxies {
+		targets[target] = true
+	}
+	return targets
+}
+
+func (h *handler) registerForward(target string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultForwardRegistryTimeout)
+	defer cancel()
+	if err := h.registry.Register(ctx, target, h.instance, h.registryTTL); err != nil {
+		h.logger.Warnf("Failed to register forward %v: %v", target, err)
+		return false
+	}
+	return true
+}
+
+func (h *handler) unregisterForward(target string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultForwardRegistryTimeout)
+	defer cancel()
+	if err := h.registry.Unregister(ctx, target, h.instance); err != nil {
+		h.logger.Warnf("Failed to unregister forward %v: %v", target, err)
+		return false
+	}
+	return true
+}
+
+func (h *handler) LookupForward(ctx context.Context, target string) (string, bool, error) {
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		if host, ok := normalizeHost(host); ok {
+			target = net.JoinHostPort(host, port)
+		}
+	}
+	if h.proxyAlive(target) {
+		return h.instance, true, nil
+	}
+	if h.registry == nil {
+		return "", false, nil
+	}
+	instance, ok, err := h.registry.Lookup(ctx, target)
+	if err != nil || !ok || instance == h.instance {
+		// 指向本实例但本地已经没有转发，说明记录已经过期
+		return "", false, err
+	}
+	return instance, true, nil
+}
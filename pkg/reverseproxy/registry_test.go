@@ -0,0 +1,117 @@
+package reverseproxy
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/clock/clocktest"
+)
+
+type blockingRegistry struct {
+	ForwardRegistry
+	release    chan struct{}
+	registered atomic.Int64
+}
+
+func (r *blockingRegistry) Register(ctx context.Context, target, instance string, ttl time.Duration) error {
+	r.registered.Add(1)
+	<-r.release
+	return r.ForwardRegistry.Register(ctx, target, instance, ttl)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met in 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestForwardRegistryIsCalledOutsideLock(t *testing.T) {
+	r := &blockingRegistry{ForwardRegistry: NewLocalForwardRegistry(), release: make(chan struct{})}
+	h := newTestHandler(t, WithForwardRegistry(r, "a", time.Minute))
+	defer close(r.release)
+
+	if err := h.addProxy("web", "80", "s", &ld{user: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return r.registered.Load() == 1 })
+
+	// Register 阻塞时 Handler 的其他操作不受影响
+	done := make(chan struct{})
+	go func() {
+		_ = h.ProxyAlive("web", "80")
+		_ = h.addProxy("api", "80", "s", &ld{user: "u"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler is blocked by the registry")
+	}
+}
+
+type countingRegistry struct {
+	ForwardRegistry
+	registered atomic.Int64
+}
+
+func (r *countingRegistry) Register(ctx context.Context, target, instance string, ttl time.Duration) error {
+	r.registered.Add(1)
+	return r.ForwardRegistry.Register(ctx, target, instance, ttl)
+}
+
+func TestForwardRegistryLease(t *testing.T) {
+	clk := clocktest.NewFake(time.Unix(0, 0))
+	local := NewLocalForwardRegistry().(*localForwardRegistry)
+	local.clock = clk
+	r := &countingRegistry{ForwardRegistry: local}
+	h := newTestHandler(t, WithClock(clk), WithForwardRegistry(r, "a", 30*time.Second))
+
+	if err := h.addProxy("web", "80", "s", &ld{user: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return r.registered.Load() == 1 })
+	if instance, ok, _ := r.Lookup(context.Background(), "web:80"); !ok || instance != "a" {
+		t.Fatalf("Lookup = %v, %v, want a", instance, ok)
+	}
+
+	// 每隔三分之一租期续约
+	clk.Advance(10 * time.Second)
+	waitFor(t, func() bool { return r.registered.Load() == 2 })
+
+	// 其他实例异常退出后，记录在租期结束后过期
+	_ = local.Register(context.Background(), "api:80", "b", time.Second)
+	if instance, ok, _ := h.LookupForward(context.Background(), "api:80"); !ok || instance != "b" {
+		t.Fatalf("LookupForward = %v, %v, want b", instance, ok)
+	}
+	clk.Advance(time.Second)
+	if _, ok, _ := h.LookupForward(context.Background(), "api:80"); ok {
+		t.Fatal("expired forward is still returned")
+	}
+
+	h.removeProxy("web", "80", "s", nil)
+	waitFor(t, func() bool {
+		_, ok, _ := r.Lookup(context.Background(), "web:80")
+		return !ok
+	})
+}
+
+func TestForwardRegistryTTL(t *testing.T) {
+	for _, ttl := range []time.Duration{-time.Second, time.Nanosecond, 2 * time.Nanosecond, MinForwardRegistryTTL - 1} {
+		if _, err := NewWithOptions(WithUnixDirectory(t.TempDir()), WithForwardRegistry(NewLocalForwardRegistry(), "a", ttl)); err == nil {
+			t.Errorf("NewWithOptions with ttl %v should fail", ttl)
+		}
+	}
+	for _, ttl := range []time.Duration{0, MinForwardRegistryTTL} {
+		h := newTestHandler(t, WithForwardRegistry(NewLocalForwardRegistry(), "a", ttl))
+		if h.registryTTL < MinForwardRegistryTTL {
+			t.Errorf("ttl %v is used as %v", ttl, h.registryTTL)
+		}
+	}
+}
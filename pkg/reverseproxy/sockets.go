@@ -0,0 +1,35 @@
+package reverseproxy
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/logger"
+)
+
+// cleanupStaleSockets 删除 dir 中已无进程监听的 *.sock 文件，通常是进程异常退出后残留的
+func cleanupStaleSockets(dir string, log logger.Logger) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.sock"))
+	if err != nil {
+		return err
+	}
+	for _, socket := range matches {
+		stat, err := os.Lstat(socket)
+		if err != nil || stat.Mode()&os.ModeSocket == 0 {
+			continue
+		}
+		c, err := net.DialTimeout("unix", socket, time.Second)
+		if err == nil {
+			_ = c.Close()
+			continue
+		}
+		if err := os.Remove(socket); err != nil {
+			log.Warnf("Failed to remove stale socket %v: %v", socket, err)
+			continue
+		}
+		log.Infof("Removed stale socket %v", socket)
+	}
+	return nil
+}
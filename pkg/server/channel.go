@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/pigeonligh/srp/pkg/logger"
+	"github.com/pigeonligh/srp/pkg/metrics"
+	"github.com/pigeonligh/srp/pkg/protocol"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// unknownChannelType 是未注册的 channel 类型在指标中使用的类型，避免客户端随意构造的类型导致指标膨胀
+const unknownChannelType = "unknown"
+
+// channelObserverOption 记录每个 channel open 被接受或拒绝的结果，需要在注册完所有 ChannelHandlers 之后执行
+func (s *server) channelObserverOption(srv *ssh.Server) error {
+	if srv.ChannelHandlers == nil {
+		srv.ChannelHandlers = make(map[string]ssh.ChannelHandler)
+		for k, v := range ssh.DefaultChannelHandlers {
+			srv.ChannelHandlers[k] = v
+		}
+	}
+	for channelType, h := range srv.ChannelHandlers {
+		srv.ChannelHandlers[channelType] = s.observeChannel(channelType, h)
+	}
+	if _, ok := srv.ChannelHandlers["default"]; !ok {
+		srv.ChannelHandlers["default"] = s.observeChannel(unknownChannelType, func(_ *ssh.Server, _ *gossh.ServerConn, newChan gossh.NewChannel, _ ssh.Context) {
+			_ = newChan.Reject(gossh.UnknownChannelType, "unsupported channel type")
+		})
+	}
+	return nil
+}
+
+func (s *server) observeChannel(channelType string, h ssh.ChannelHandler) ssh.ChannelHandler {
+	return func(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+		h(srv, conn, &observedChannel{NewChannel: newChan, s: s, ctx: ctx, channelType: channelType}, ctx)
+	}
+}
+
+type observedChannel struct {
+	gossh.NewChannel
+	s           *server
+	ctx         ssh.Context
+	channelType string
+}
+
+func (c *observedChannel) Accept() (gossh.Channel, <-chan *gossh.Request, error) {
+	ch, reqs, err := c.NewChannel.Accept()
+	if err != nil {
+		return ch, reqs, err
+	}
+	if m, ok := metrics.FromContext(c.ctx).(metrics.ChannelMetrics); ok {
+		m.ChannelOpened(c.channelType, true, "")
+	}
+	if l := c.s.log(); logger.DebugEnabled(l) {
+		l.Debugf("Accepted %v channel to %v from user %v in %v", c.channelType, channelTarget(c.NewChannel), c.ctx.User(), c.ctx.SessionID())
+	}
+	return ch, reqs, nil
+}
+
+func (c *observedChannel) Reject(reason gossh.RejectionReason, message string) error {
+	if m, ok := metrics.FromContext(c.ctx).(metrics.ChannelMetrics); ok {
+		m.ChannelOpened(c.channelType, false, reason.String())
+	}
+	l := logger.WithField(c.s.log(), "reason", reason.String())
+	l.Warnf("Rejected %q channel to %v from user %v in %v (%v): %v",
+		c.ChannelType(), channelTarget(c.NewChannel), c.ctx.User(), c.ctx.SessionID(), c.ctx.RemoteAddr(), message)
+	return c.NewChannel.Reject(reason, message)
+}
+
+// channelTarget 返回 direct-tcpip 等 channel 的目标地址，其他 channel 返回 "-"
+func channelTarget(newChan gossh.NewChannel) string {
+	switch newChan.ChannelType() {
+	case protocol.DirectTCPIPChannelType, protocol.DirectUDPChannelType:
+		var payload protocol.DirectPayload
+		if err := gossh.Unmarshal(newChan.ExtraData(), &payload); err == nil {
+			return net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port))
+		}
+	}
+	return "-"
+}
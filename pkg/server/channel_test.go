@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/pigeonligh/srp/pkg/protocol"
+	"github.com/sirupsen/logrus"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// testContext 实现测试用到的 ssh.Context 方法，其他方法调用时会 panic
+type testContext struct {
+	ssh.Context
+	ctx    context.Context
+	values map[any]any
+}
+
+func newTestContext(ctx context.Context) *testContext {
+	return &testContext{ctx: ctx, values: make(map[any]any)}
+}
+
+func (c *testContext) Value(key any) any {
+	if v, ok := c.values[key]; ok {
+		return v
+	}
+	return c.ctx.Value(key)
+}
+
+func (c *testContext) SetValue(key, value any)     { c.values[key] = value }
+func (c *testContext) Deadline() (time.Time, bool) { return c.ctx.Deadline() }
+func (c *testContext) Done() <-chan struct{}       { return c.ctx.Done() }
+func (c *testContext) Err() error                  { return c.ctx.Err() }
+func (c *testContext) User() string                { return "u" }
+func (c *testContext) SessionID() string           { return "s" }
+
+type testNewChannel struct {
+	gossh.NewChannel
+	extra []byte
+}
+
+func (c testNewChannel) Accept() (gossh.Channel, <-chan *gossh.Request, error) { return nil, nil, nil }
+func (c testNewChannel) ChannelType() string                                   { return protocol.DirectTCPIPChannelType }
+func (c testNewChannel) ExtraData() []byte                                     { return c.extra }
+
+func TestObservedChannelAcceptAllocs(t *testing.T) {
+	l := logrus.New()
+	l.SetLevel(logrus.InfoLevel)
+	c := &observedChannel{
+		NewChannel:  testNewChannel{extra: gossh.Marshal(&protocol.DirectPayload{Host: "example.com", Port: 80})},
+		s:           &server{logger: l},
+		ctx:         newTestContext(context.Background()),
+		channelType: protocol.DirectTCPIPChannelType,
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _, _ = c.Accept()
+	})
+	if allocs > 0 {
+		t.Fatalf("Accept allocates %v times with debug logging disabled", allocs)
+	}
+}
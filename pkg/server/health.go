@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/pigeonligh/srp/pkg/logger"
+	"github.com/pigeonligh/srp/pkg/nets"
+)
+
+// healthHandler 提供 /healthz 和 /readyz，/readyz 只在 SSH 监听已建立且未开始停止时返回 200
+func (s *server) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+// runHealth 在 l 上提供健康检查直到 ctx 结束，错误只记录日志，不影响 SSH 服务
+func (s *server) runHealth(ctx context.Context, l net.Listener) {
+	ctx = nets.ContextWithServerName(ctx, s.name+"-health")
+	if s.logger != nil {
+		ctx = logger.ContextWithLogger(ctx, s.logger)
+	}
+	if err := nets.RunNetServer(ctx, &http.Server{Handler: s.healthHandler()}, l); err != nil {
+		s.log().Warnf("Health endpoint stopped: %v", err)
+	}
+}
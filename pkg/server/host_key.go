@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// hostKeyOption 从 hostKeyPaths 加载 host key，同时提供给客户端协商
+// 每个新连接都会使用当时最新的 host key，已有连接不受 ReloadHostKey 影响
+func (s *server) hostKeyOption(srv *ssh.Server) error {
+	if len(s.hostKeyPaths) == 0 {
+		return nil
+	}
+	if s.generateHostKey {
+		// 文件不存在时生成 Ed25519 key
+		if err := wish.WithHostKeyPath(s.hostKeyPaths[0])(&ssh.Server{}); err != nil {
+			return fmt.Errorf("generate host key %v: %w", s.hostKeyPaths[0], err)
+		}
+	}
+	if err := s.ReloadHostKey(); err != nil {
+		return err
+	}
+	srv.HostSigners = *s.hostSigners.Load()
+
+	next := srv.ServerConfigCallback
+	srv.ServerConfigCallback = func(ctx ssh.Context) *gossh.ServerConfig {
+		// ServerConfigCallback 在持有 srv 的锁时调用，随后 srv.HostSigners 会被加入到 config 中
+		srv.HostSigners = *s.hostSigners.Load()
+		if next != nil {
+			return next(ctx)
+		}
+		return &gossh.ServerConfig{}
+	}
+	return nil
+}
+
+// ReloadHostKey 重新读取所有 host key，无法读取的文件会被跳过，但至少需要成功加载一个
+func (s *server) ReloadHostKey() error {
+	if len(s.hostKeyPaths) == 0 {
+		return fmt.Errorf("host key path is not set")
+	}
+	signers := make([]ssh.Signer, 0, len(s.hostKeyPaths))
+	for _, path := range s.hostKeyPaths {
+		signer, err := loadHostKey(path)
+		if err != nil {
+			s.log().Warnf("Failed to load host key %v: %v", path, err)
+			continue
+		}
+		s.log().Infof("Host key loaded from %v: %v %v", path, signer.PublicKey().Type(), gossh.FingerprintSHA256(signer.PublicKey()))
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		return fmt.Errorf("no host key is loaded from %v", s.hostKeyPaths)
+	}
+	s.hostSigners.Store(&signers)
+	return nil
+}
+
+func loadHostKey(path string) (ssh.Signer, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return gossh.ParsePrivateKey(pemBytes)
+}
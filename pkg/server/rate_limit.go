@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultRateLimiterIdleTTL 为单个 IP 的限流器在无新连接后保留的时间
+var DefaultRateLimiterIdleTTL = 10 * time.Minute
+
+type ipRateLimiter struct {
+	limit  rate.Limit
+	burst  int
+	exempt []netip.Prefix
+
+	mu        sync.Mutex
+	limiters  map[netip.Addr]*ipLimiterEntry
+	lastSweep time.Time
+}
+
+type ipLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newIPRateLimiter(limit rate.Limit, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		limit:    limit,
+		burst:    burst,
+		limiters: make(map[netip.Addr]*ipLimiterEntry),
+	}
+}
+
+func (l *ipRateLimiter) Allow(addr net.Addr) bool {
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		// 非 TCP 连接（如 unix socket）不做限制
+		return true
+	}
+	ip := ap.Addr().Unmap()
+	for _, p := range l.exempt {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > DefaultRateLimiterIdleTTL {
+		for k, e := range l.limiters {
+			if now.Sub(e.lastSeen) > DefaultRateLimiterIdleTTL {
+				delete(l.limiters, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	e, ok := l.limiters[ip]
+	if !ok {
+		e = &ipLimiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[ip] = e
+	}
+	e.lastSeen = now
+	return e.limiter.AllowN(now, 1)
+}
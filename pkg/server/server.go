@@ -1,20 +1,41 @@
 package server
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/netip"
+	"sync/atomic"
+	"time"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
 	"github.com/charmbracelet/wish/logging"
+	"github.com/pigeonligh/srp/pkg/auth"
+	"github.com/pigeonligh/srp/pkg/events"
+	"github.com/pigeonligh/srp/pkg/logger"
+	"github.com/pigeonligh/srp/pkg/metrics"
 	"github.com/pigeonligh/srp/pkg/nets"
 	"github.com/pigeonligh/srp/pkg/proxy"
 	"github.com/pigeonligh/srp/pkg/reverseproxy"
 )
 
+// DefaultTLSHandshakeTimeout 为开启 WithTLS 时每个连接完成 TLS 握手的最长时间
+var DefaultTLSHandshakeTimeout = 10 * time.Second
+
+// ErrNotDrained 表示停止时未能在 ShutdownTimeout 内等到所有连接关闭，剩余连接已被强制关闭
+var ErrNotDrained = errors.New("server is not drained before shutdown timeout")
+
 type Server interface {
+	// Run 在 ctx 结束后停止接受新连接，并等待已有连接关闭，超时后强制关闭并返回 ErrNotDrained
 	Run(ctx context.Context) error
+
+	// ReloadHostKey 重新读取 WithHostKeyPath 或 WithHostKeyPaths 设置的 host key，仅对之后的新连接生效
+	ReloadHostKey() error
 }
 
 type server struct {
@@ -26,7 +47,32 @@ type server struct {
 	h  ssh.Handler
 	l  net.Listener
 
-	sshOptions []ssh.Option
+	sshOptions  []ssh.Option
+	authMethods map[string]bool
+	metrics     metrics.Metrics
+	events      events.Events
+	logger      logger.Logger
+
+	maxConnections int
+	connections    atomic.Int64
+	rateLimiter    *ipRateLimiter
+	rateExempt     []netip.Prefix
+
+	shutdownTimeout time.Duration
+
+	banner func(ssh.Context) string
+
+	tlsConfig  *tls.Config
+	algorithms nets.SSHAlgorithms
+
+	healthAddr string
+	ready      atomic.Bool
+
+	commands map[string]ssh.Handler
+
+	hostKeyPaths    []string
+	generateHostKey bool
+	hostSigners     atomic.Pointer[[]ssh.Signer]
 }
 
 func New(name string, options ...Option) Server {
@@ -46,16 +92,18 @@ func (s *server) HandleSession(_ ssh.Handler) ssh.Handler {
 			return
 		}
 
-		if len(sess.Command()) > 0 {
-			fmt.Fprintln(sess, "Disallowed command")
-		} else {
-			_, _, isPty := sess.Pty()
-			if !isPty {
-				fmt.Fprintf(sess, "Welcome to %v, @%v!\n", s.name, sess.User())
-			} else {
-				fmt.Fprintln(sess, "PTY allocation request failed")
+		// 默认只提供转发，除 WithSessionCommand 允许的命令外，shell 和 exec 都会被拒绝
+		if command := sess.Command(); len(command) > 0 {
+			if h, ok := s.commands[command[0]]; ok {
+				h(sess)
+				return
 			}
+			s.log().Warnf("Rejected command %q from user %v in %v", command[0], sess.User(), sess.Context().SessionID())
+			fmt.Fprintf(sess.Stderr(), "Command %q is not allowed, %v only provides port forwarding\n", command[0], s.name)
+		} else {
+			fmt.Fprintf(sess.Stderr(), "Welcome to %v, @%v! Shell access is not available, %v only provides port forwarding\n", s.name, sess.User(), s.name)
 		}
+		_ = sess.Exit(1)
 	}
 
 	if s.m != nil {
@@ -65,16 +113,35 @@ func (s *server) HandleSession(_ ssh.Handler) ssh.Handler {
 }
 
 func (s *server) Run(ctx context.Context) error {
+	if s.rateLimiter != nil {
+		s.rateLimiter.exempt = s.rateExempt
+	}
+	if err := s.algorithms.ValidateServer(); err != nil {
+		return err
+	}
+	if s.authMethods != nil {
+		if err := auth.CheckMethods(s.authMethods); err != nil {
+			return err
+		}
+	}
+
 	options := make([]ssh.Option, 0)
 	options = append(options, s.sshOptions...)
 	options = append(options,
+		s.hostKeyOption,
+		s.algorithmsOption,
+		s.connOption,
 		s.channelOption,
+		s.channelObserverOption,
 		s.requestOption,
+		s.ptyOption,
 		s.passwordOption,
 		s.publickeyOption,
+		s.keyboardInteractiveOption,
+		s.bannerOption,
 		wish.WithMiddleware(
 			s.HandleSession,
-			logging.Middleware(),
+			s.loggingMiddleware(),
 		),
 	)
 
@@ -82,7 +149,110 @@ func (s *server) Run(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("create SSH server: %w", err)
 	}
+	if srv.PasswordHandler == nil && srv.PublicKeyHandler == nil && srv.KeyboardInteractiveHandler == nil {
+		// 没有任何认证方式时 ssh.Server 会设置 NoClientAuth，客户端无需认证即可登录
+		return fmt.Errorf("no authentication method is available, check WithAuthMethods and the handlers")
+	}
+
+	var healthListener net.Listener
+	if s.healthAddr != "" {
+		healthListener, err = net.Listen("tcp", s.healthAddr)
+		if err != nil {
+			return fmt.Errorf("listen health endpoint on %v: %w", s.healthAddr, err)
+		}
+	}
+	l := s.l
+	if l == nil {
+		// 与 ssh.Server.ListenAndServe 相同，但在开始服务前就能确定监听已经建立
+		l, err = net.Listen("tcp", cmp.Or(srv.Addr, ":22"))
+		if err != nil {
+			if healthListener != nil {
+				_ = healthListener.Close()
+			}
+			return fmt.Errorf("listen on %v: %w", cmp.Or(srv.Addr, ":22"), err)
+		}
+	}
+	if healthListener != nil {
+		healthCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		healthDone := make(chan struct{})
+		go func() {
+			defer close(healthDone)
+			s.runHealth(healthCtx, healthListener)
+		}()
+		// 存活检查在 SSH 服务停止后才关闭
+		defer func() {
+			cancel()
+			<-healthDone
+		}()
+	}
 
 	ctx = nets.ContextWithServerName(ctx, s.name)
-	return nets.RunNetServer(ctx, srv, s.l)
+	if s.logger != nil {
+		ctx = logger.ContextWithLogger(ctx, s.logger)
+	}
+	if s.shutdownTimeout > 0 {
+		ctx = nets.ContextWithStopTimeout(ctx, s.shutdownTimeout)
+	}
+	waiter, _ := s.rp.(reverseproxy.Waiter)
+	s.ready.Store(true)
+	err = nets.RunNetServer(ctx, &drainServer{
+		Server:  srv,
+		waiter:  waiter,
+		log:     s.log(),
+		timeout: nets.GetStopTimeoutFromContext(ctx),
+		ready:   &s.ready,
+	}, l)
+	s.ready.Store(false)
+	if closer, ok := s.rp.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil {
+			s.log().Warnf("Failed to close reverse proxy: %v", closeErr)
+		}
+	}
+	return err
+}
+
+// drainServer 在 ssh.Server 停止后等待 reverseproxy 的转发清理完成，超时则强制关闭所有连接
+type drainServer struct {
+	*ssh.Server
+	// 为空时不等待转发的清理
+	waiter  reverseproxy.Waiter
+	log     logger.Logger
+	timeout time.Duration
+	ready   *atomic.Bool
+}
+
+func (d *drainServer) Shutdown(ctx context.Context) error {
+	d.ready.Store(false)
+	err := d.Server.Shutdown(ctx)
+	if err == nil && d.waiter != nil {
+		err = d.waiter.Wait(ctx)
+	}
+	if ctx.Err() == nil {
+		return err
+	}
+
+	d.log.Warnf("Server is not drained in time, force closing: %v", err)
+	_ = d.Server.Close()
+	if d.waiter != nil {
+		waitCtx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		defer cancel()
+		if err := d.waiter.Wait(waitCtx); err != nil {
+			d.log.Warnf("Forwards are not cleaned up: %v", err)
+		}
+	}
+	return ErrNotDrained
+}
+
+func (s *server) log() logger.Logger {
+	if s.logger != nil {
+		return s.logger
+	}
+	return logger.Default()
+}
+
+func (s *server) loggingMiddleware() wish.Middleware {
+	if s.logger != nil {
+		return logging.MiddlewareWithLogger(logger.Printer{Logger: s.logger})
+	}
+	return logging.Middleware()
 }
@@ -1,12 +1,20 @@
 package server
 
 import (
+	"crypto/tls"
 	"net"
+	"net/netip"
+	"time"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
+	"github.com/pigeonligh/srp/pkg/events"
+	"github.com/pigeonligh/srp/pkg/logger"
+	"github.com/pigeonligh/srp/pkg/metrics"
+	"github.com/pigeonligh/srp/pkg/nets"
 	"github.com/pigeonligh/srp/pkg/proxy"
 	"github.com/pigeonligh/srp/pkg/reverseproxy"
+	"golang.org/x/time/rate"
 )
 
 type Option func(s *server)
@@ -23,26 +31,152 @@ func WithProxy(p proxy.Handler) Option {
 	}
 }
 
+// 如只传入 auth.MethodPublicKey 以禁止密码登录，未设置时提供所有方式，限制后没有可用的认证方式时 Run 返回错误
+// 如只传入 auth.MethodPublicKey 以禁止密码登录，未设置时提供所有方式
+func WithAuthMethods(methods ...string) Option {
+	return func(s *server) {
+		s.authMethods = make(map[string]bool, len(methods))
+		for _, m := range methods {
+			s.authMethods[m] = true
+		}
+	}
+}
+
 func WithWishMiddleware(m wish.Middleware) Option {
 	return func(s *server) {
 		s.m = m
 	}
 }
 
+// WithSSHHandler 自行处理 session，此时 shell、exec 和 PTY 请求都交给 h，不再限制为只提供转发
 func WithSSHHandler(h ssh.Handler) Option {
 	return func(s *server) {
 		s.h = h
 	}
 }
 
+// WithSessionCommand 允许客户端通过 exec 执行名为 name 的命令，由 h 处理，命令参数通过 sess.Command() 获取
+func WithSessionCommand(name string, h ssh.Handler) Option {
+	return func(s *server) {
+		if s.commands == nil {
+			s.commands = make(map[string]ssh.Handler)
+		}
+		s.commands[name] = h
+	}
+}
+
 func WithSSHOptions(options ...ssh.Option) Option {
 	return func(s *server) {
 		s.sshOptions = append(s.sshOptions, options...)
 	}
 }
 
+// WithHostKeyPath 设置 host key 文件，文件不存在时自动生成，可以通过 ReloadHostKey 重新加载
+func WithHostKeyPath(path string) Option {
+	return func(s *server) {
+		s.hostKeyPaths = []string{path}
+		s.generateHostKey = true
+	}
+}
+
+// WithHostKeyPaths 设置多个不同类型的 host key 文件（如 RSA、Ed25519、ECDSA），由客户端协商使用
+func WithHostKeyPaths(paths ...string) Option {
+	return func(s *server) {
+		s.hostKeyPaths = paths
+		s.generateHostKey = false
+	}
+}
+
+// WithTLS 让服务端在 TLS 之上提供 SSH，用于前置负载均衡按 SNI 路由或与 HTTPS 共用端口，
+// config 未设置 NextProtos 时使用 nets.DefaultTLSSSHProtocol 作为 ALPN，客户端见 nets.TLSSSHDialer
+func WithTLS(config *tls.Config) Option {
+	return func(s *server) {
+		s.tlsConfig = config.Clone()
+		if s.tlsConfig != nil && len(s.tlsConfig.NextProtos) == 0 {
+			s.tlsConfig.NextProtos = []string{nets.DefaultTLSSSHProtocol}
+		}
+	}
+}
+
+// WithAlgorithms 限制协商使用的加密、MAC 和密钥交换算法，Run 时校验算法名称
+func WithAlgorithms(algorithms nets.SSHAlgorithms) Option {
+	return func(s *server) {
+		s.algorithms = algorithms
+	}
+}
+
 func WithListener(l net.Listener) Option {
 	return func(s *server) {
 		s.l = l
 	}
 }
+
+// WithHealthEndpoint 在 addr 上提供 HTTP 健康检查，/healthz 表示进程存活，
+// /readyz 在 SSH 监听建立后返回 200，开始停止后返回 503，与 metrics 的端口分开以便分别设置访问控制
+func WithHealthEndpoint(addr string) Option {
+	return func(s *server) {
+		s.healthAddr = addr
+	}
+}
+
+func WithMetrics(m metrics.Metrics) Option {
+	return func(s *server) {
+		s.metrics = m
+	}
+}
+
+// WithLogger 设置服务器自身的日志，reverseproxy 与 proxy 的日志通过各自的 WithLogger 设置
+func WithLogger(l logger.Logger) Option {
+	return func(s *server) {
+		s.logger = l
+	}
+}
+
+// WithMaxConnections 限制同时存在的 SSH 连接数，超出时直接断开新连接，为 0 时不限制
+func WithMaxConnections(n int) Option {
+	return func(s *server) {
+		s.maxConnections = n
+	}
+}
+
+// WithConnRateLimit 按来源 IP 限制新连接的速率，超出时在 SSH 握手前断开
+func WithConnRateLimit(perIP rate.Limit, burst int) Option {
+	return func(s *server) {
+		s.rateLimiter = newIPRateLimiter(perIP, burst)
+	}
+}
+
+// WithConnRateLimitExempt 设置不受 WithConnRateLimit 限制的网段，如内部监控所在的网段
+func WithConnRateLimitExempt(prefixes ...netip.Prefix) Option {
+	return func(s *server) {
+		s.rateExempt = append(s.rateExempt, prefixes...)
+	}
+}
+
+// WithShutdownTimeout 设置停止时等待已有连接和转发关闭的时间，未设置时为 30s
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(s *server) {
+		s.shutdownTimeout = d
+	}
+}
+
+// WithBanner 设置认证前展示给客户端的 banner，如法律声明等
+func WithBanner(text string) Option {
+	return WithBannerFunc(func(ssh.Context) string {
+		return text
+	})
+}
+
+// WithBannerFunc 与 WithBanner 相同，但可以根据连接（如用户名）返回不同的 banner
+func WithBannerFunc(f func(ssh.Context) string) Option {
+	return func(s *server) {
+		s.banner = f
+	}
+}
+
+// WithEvents 设置审计事件的处理，事件在单独的 goroutine 中处理
+func WithEvents(e events.Events) Option {
+	return func(s *server) {
+		s.events = events.Async(e)
+	}
+}
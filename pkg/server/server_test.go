@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pigeonligh/srp/pkg/auth"
+	"github.com/pigeonligh/srp/pkg/proxy"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestRunRejectsUnauthenticatedClients(t *testing.T) {
+	hostKey := filepath.Join(t.TempDir(), "host_key")
+
+	// proxy.Handler 不支持 keyboard-interactive，没有任何认证方式可用时不能退化为无需认证
+	s := New("test", WithProxy(proxy.NewWithOptions()), WithAuthMethods(auth.MethodKeyboardInteractive), WithHostKeyPath(hostKey))
+	if err := s.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "no authentication method") {
+		t.Fatalf("Run = %v, want no authentication method error", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = New("test", WithProxy(proxy.NewWithOptions()), WithAuthMethods(auth.MethodPublicKey), WithHostKeyPath(hostKey), WithListener(l))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	client, err := gossh.Dial("tcp", l.Addr().String(), &gossh.ClientConfig{
+		User:            "anonymous",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err == nil {
+		_ = client.Close()
+		t.Fatal("client without credentials should be rejected")
+	}
+	if !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Fatalf("Dial = %v, want authentication failure", err)
+	}
+}
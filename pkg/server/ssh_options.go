@@ -2,11 +2,80 @@ package server
 
 import (
 	"cmp"
+	"context"
+	"crypto/tls"
+	"net"
 
 	"github.com/charmbracelet/ssh"
+	"github.com/pigeonligh/srp/pkg/auth"
+	"github.com/pigeonligh/srp/pkg/events"
+	"github.com/pigeonligh/srp/pkg/metrics"
 	"github.com/pigeonligh/srp/pkg/protocol"
+	gossh "golang.org/x/crypto/ssh"
 )
 
+func (s *server) connOption(srv *ssh.Server) error {
+	next := srv.ConnCallback
+	srv.ConnCallback = func(ctx ssh.Context, conn net.Conn) net.Conn {
+		if next != nil {
+			if conn = next(ctx, conn); conn == nil {
+				return nil
+			}
+		}
+		if s.rateLimiter != nil && !s.rateLimiter.Allow(conn.RemoteAddr()) {
+			s.log().Warnf("Connection rate limit exceeded, rejected %v", conn.RemoteAddr())
+			return nil
+		}
+		var release func()
+		if s.maxConnections > 0 {
+			if n := s.connections.Add(1); n > int64(s.maxConnections) {
+				s.connections.Add(-1)
+				s.log().Warnf("Too many connections (limit %v), rejected %v", s.maxConnections, conn.RemoteAddr())
+				return nil
+			}
+			stop := context.AfterFunc(ctx, func() {
+				s.connections.Add(-1)
+			})
+			// 返回 nil 时 ssh.Server 不会结束 ctx，需要自行归还名额
+			release = func() {
+				if stop() {
+					s.connections.Add(-1)
+				}
+			}
+		}
+		if s.tlsConfig != nil {
+			if conn = s.tlsHandshake(ctx, conn); conn == nil {
+				if release != nil {
+					release()
+				}
+				return nil
+			}
+		}
+		if s.events != nil {
+			events.SetContextEvents(ctx, s.events)
+		}
+		if s.metrics != nil {
+			metrics.SetContextMetrics(ctx, s.metrics)
+			s.metrics.ConnectionOpened()
+			context.AfterFunc(ctx, s.metrics.ConnectionClosed)
+		}
+		return conn
+	}
+	return nil
+}
+
+// tlsHandshake 在 SSH 握手前完成 TLS 握手，失败时只关闭这个连接
+func (s *server) tlsHandshake(ctx context.Context, conn net.Conn) net.Conn {
+	tlsConn := tls.Server(conn, s.tlsConfig)
+	hctx, cancel := context.WithTimeout(ctx, DefaultTLSHandshakeTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(hctx); err != nil {
+		s.log().Warnf("TLS handshake with %v failed: %v", conn.RemoteAddr(), err)
+		return nil
+	}
+	return tlsConn
+}
+
 func (s *server) channelOption(srv *ssh.Server) error {
 	if s.p == nil {
 		return nil
@@ -15,7 +84,8 @@ func (s *server) channelOption(srv *ssh.Server) error {
 	if srv.ChannelHandlers == nil {
 		srv.ChannelHandlers = make(map[string]ssh.ChannelHandler)
 	}
-	srv.ChannelHandlers["direct-tcpip"] = s.p.HandleProxy
+	srv.ChannelHandlers[protocol.DirectTCPIPChannelType] = s.p.HandleProxy
+	srv.ChannelHandlers[protocol.DirectUDPChannelType] = s.p.HandleUDPProxy
 	srv.ChannelHandlers["session"] = ssh.DefaultSessionHandler
 	return nil
 }
@@ -26,34 +96,134 @@ func (s *server) requestOption(srv *ssh.Server) error {
 	}
 
 	srv.RequestHandlers = map[string]ssh.RequestHandler{
-		protocol.ForwardRequestType: s.rp.HandleSSHRequest,
-		protocol.CancelRequestType:  s.rp.HandleSSHRequest,
+		protocol.ForwardRequestType:            s.rp.HandleSSHRequest,
+		protocol.CancelRequestType:             s.rp.HandleSSHRequest,
+		protocol.TCPIPForwardRequestType:       s.rp.HandleSSHRequest,
+		protocol.CancelTCPIPForwardRequestType: s.rp.HandleSSHRequest,
 	}
 	return nil
 }
 
+// ptyOption 拒绝 pty-req，只有通过 WithSSHHandler 自行处理 session 时才允许分配 PTY
+func (s *server) ptyOption(srv *ssh.Server) error {
+	srv.PtyCallback = func(ctx ssh.Context, _ ssh.Pty) bool {
+		if s.h != nil {
+			return true
+		}
+		s.log().Infof("Rejected PTY request from user %v in %v", ctx.User(), ctx.SessionID())
+		return false
+	}
+	return nil
+}
+
+func (s *server) authMethodEnabled(method string) bool {
+	return s.authMethods == nil || s.authMethods[method]
+}
+
 func (s *server) passwordOption(srv *ssh.Server) error {
-	return ssh.PasswordAuth(func(ctx ssh.Context, password string) bool {
-		ret := make([]bool, 0)
-		if s.rp != nil {
-			ret = append(ret, s.rp.PasswordHandler()(ctx, password))
+	if !s.authMethodEnabled(auth.MethodPassword) {
+		return nil
+	}
+	handlers := make([]ssh.PasswordHandler, 0, 2)
+	if s.rp != nil {
+		if h := s.rp.PasswordHandler(); h != nil {
+			handlers = append(handlers, h)
+		}
+	}
+	if s.p != nil {
+		if h := s.p.PasswordHandler(); h != nil {
+			handlers = append(handlers, h)
 		}
-		if s.p != nil {
-			ret = append(ret, s.p.PasswordHandler()(ctx, password))
+	}
+	if len(handlers) == 0 && (s.rp != nil || s.p != nil) {
+		// 密码认证均未启用，不提供给客户端
+		return nil
+	}
+	return ssh.PasswordAuth(func(ctx ssh.Context, password string) bool {
+		ret := make([]bool, 0, len(handlers))
+		for _, h := range handlers {
+			ret = append(ret, h(ctx, password))
 		}
-		return cmp.Or(ret...) || len(ret) == 0
+		ok := cmp.Or(ret...) || len(ret) == 0
+		metrics.FromContext(ctx).Authenticated(auth.MethodPassword, ok)
+		events.FromContext(ctx).Authenticated(authEvent(ctx, auth.MethodPassword, ok))
+		return ok
 	})(srv)
 }
 
 func (s *server) publickeyOption(srv *ssh.Server) error {
-	return ssh.PublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
-		ret := make([]bool, 0)
-		if s.rp != nil {
-			ret = append(ret, s.rp.PublicKeyHandler()(ctx, key))
+	if !s.authMethodEnabled(auth.MethodPublicKey) {
+		return nil
+	}
+	handlers := make([]ssh.PublicKeyHandler, 0, 2)
+	if s.rp != nil {
+		if h := s.rp.PublicKeyHandler(); h != nil {
+			handlers = append(handlers, h)
 		}
-		if s.p != nil {
-			ret = append(ret, s.p.PublicKeyHandler()(ctx, key))
+	}
+	if s.p != nil {
+		if h := s.p.PublicKeyHandler(); h != nil {
+			handlers = append(handlers, h)
 		}
-		return cmp.Or(ret...) || len(ret) == 0
+	}
+	if len(handlers) == 0 && (s.rp != nil || s.p != nil) {
+		return nil
+	}
+	return ssh.PublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+		ret := make([]bool, 0, len(handlers))
+		for _, h := range handlers {
+			ret = append(ret, h(ctx, key))
+		}
+		ok := cmp.Or(ret...) || len(ret) == 0
+		metrics.FromContext(ctx).Authenticated(auth.MethodPublicKey, ok)
+		events.FromContext(ctx).Authenticated(authEvent(ctx, auth.MethodPublicKey, ok))
+		return ok
 	})(srv)
 }
+
+func (s *server) keyboardInteractiveOption(srv *ssh.Server) error {
+	if s.rp == nil || !s.authMethodEnabled(auth.MethodKeyboardInteractive) {
+		return nil
+	}
+	h := s.rp.KeyboardInteractiveHandler()
+	if h == nil {
+		return nil
+	}
+	return ssh.KeyboardInteractiveAuth(func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+		ok := h(ctx, challenger)
+		metrics.FromContext(ctx).Authenticated(auth.MethodKeyboardInteractive, ok)
+		events.FromContext(ctx).Authenticated(authEvent(ctx, auth.MethodKeyboardInteractive, ok))
+		return ok
+	})(srv)
+}
+
+func (s *server) bannerOption(srv *ssh.Server) error {
+	if s.banner != nil {
+		srv.BannerHandler = s.banner
+	}
+	return nil
+}
+
+// algorithmsOption 在每个连接的 ServerConfig 中设置 WithAlgorithms 限制的算法
+func (s *server) algorithmsOption(srv *ssh.Server) error {
+	next := srv.ServerConfigCallback
+	srv.ServerConfigCallback = func(ctx ssh.Context) *gossh.ServerConfig {
+		config := &gossh.ServerConfig{}
+		if next != nil {
+			config = next(ctx)
+		}
+		s.algorithms.Apply(&config.Config)
+		return config
+	}
+	return nil
+}
+
+func authEvent(ctx ssh.Context, method string, success bool) events.AuthEvent {
+	return events.AuthEvent{
+		User:       ctx.User(),
+		SessionID:  ctx.SessionID(),
+		Method:     method,
+		RemoteAddr: ctx.RemoteAddr(),
+		Success:    success,
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/pigeonligh/srp/pkg/auth"
+	"github.com/pigeonligh/srp/pkg/metrics"
+	"github.com/pigeonligh/srp/pkg/proxy"
+)
+
+type connectionMetrics struct {
+	metrics.Nop
+	open atomic.Int64
+}
+
+func (m *connectionMetrics) ConnectionOpened() { m.open.Add(1) }
+func (m *connectionMetrics) ConnectionClosed() { m.open.Add(-1) }
+
+func TestFailedTLSHandshakeReleasesConnection(t *testing.T) {
+	m := &connectionMetrics{}
+	s := New("test", WithTLS(&tls.Config{}), WithMaxConnections(2), WithMetrics(m)).(*server)
+	srv := &ssh.Server{}
+	if err := s.connOption(srv); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		c1, c2 := net.Pipe()
+		go func() {
+			// 不是 TLS ClientHello，握手立即失败
+			_, _ = c2.Write([]byte("SSH-2.0-probe\r\n\r\n\r\n"))
+			_ = c2.Close()
+		}()
+		if conn := srv.ConnCallback(newTestContext(context.Background()), c1); conn != nil {
+			t.Fatal("connection should be rejected after a failed TLS handshake")
+		}
+		_ = c1.Close()
+	}
+	if n := s.connections.Load(); n != 0 {
+		t.Fatalf("connections = %v, want 0", n)
+	}
+	if n := m.open.Load(); n != 0 {
+		t.Fatalf("open connections gauge = %v, want 0", n)
+	}
+}
+
+func TestAuthMethodsApplyToProxyHandler(t *testing.T) {
+	s := New("test", WithProxy(proxy.NewWithOptions()), WithAuthMethods(auth.MethodPublicKey)).(*server)
+	srv := &ssh.Server{}
+	for _, option := range []ssh.Option{s.passwordOption, s.publickeyOption, s.keyboardInteractiveOption} {
+		if err := option(srv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if srv.PasswordHandler != nil {
+		t.Fatal("password authentication should not be offered")
+	}
+	if srv.PublicKeyHandler == nil {
+		t.Fatal("public key authentication should be offered")
+	}
+
+	for _, methods := range [][]string{{}, {"hostbased"}} {
+		s := New("test", WithProxy(proxy.NewWithOptions()), WithAuthMethods(methods...))
+		if err := s.Run(context.Background()); err == nil {
+			t.Fatalf("Run with methods %v should fail", methods)
+		}
+	}
+}